@@ -0,0 +1,65 @@
+package propagatedstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BatchSaver is implemented by datastores that can save several models in a single call.
+type BatchSaver interface {
+	// SaveBatch saves every model. Models that could not be saved are reported in a *BatchError; the
+	// others are saved regardless.
+	SaveBatch(ctx context.Context, models []*Model) error
+}
+
+// BatchError reports the models of a batch that failed, by their index in the batch.
+type BatchError struct {
+	Errors map[int]error
+}
+
+func (e *BatchError) Error() string {
+	indexes := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	messages := make([]string, len(indexes))
+	for n, i := range indexes {
+		messages[n] = fmt.Sprintf("%d: %s", i, e.Errors[i])
+	}
+	return fmt.Sprintf("%d models of batch failed: %s", len(indexes), strings.Join(messages, "; "))
+}
+
+// Is reports whether any of the failures of the batch is target.
+func (e *BatchError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveBatch saves models to datastore, in a single call if it is a BatchSaver and one by one otherwise.
+// Models that could not be saved are reported in a *BatchError.
+func SaveBatch(ctx context.Context, datastore Datastore, models []*Model) error {
+	if saver, ok := datastore.(BatchSaver); ok {
+		return saver.SaveBatch(ctx, models)
+	}
+
+	errs := make(map[int]error)
+	for i, model := range models {
+		if err := datastore.Save(ctx, model); err != nil {
+			errs[i] = err
+		}
+	}
+
+	if len(errs) > 0 {
+		return &BatchError{Errors: errs}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+// Package bloom provides a propagated storage datastore that keeps a bloom filter of the stored IDs
+// per Type in front of another datastore, such as the DynamoDB one. Reads of IDs the filter knows are
+// not stored fail with propagatedstorage.ErrNotFound without reaching the backing datastore, which a
+// propagated storage service answers from its fallback service right away.
+//
+// The filters are built by scanning the backing datastore, which must be a
+// propagatedstorage.IDScanner, and kept up to date on Save and Delete through the datastore. Changes
+// made to the backing datastore by others are only picked up by Rebuild.
+package bloom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+)
+
+const (
+	// DefaultExpectedItems is the number of IDs per Type the filters are sized for unless
+	// WithExpectedItems says otherwise.
+	DefaultExpectedItems = 100000
+	// DefaultFalsePositiveRate is the false positive rate the filters are sized for unless
+	// WithFalsePositiveRate says otherwise.
+	DefaultFalsePositiveRate = 0.01
+)
+
+// Datastore is a datastore that skips reads of IDs a per-Type bloom filter knows are not stored. Types
+// without a filter are passed through. It is safe for concurrent use.
+type Datastore struct {
+	backing           propagatedstorage.Datastore
+	types             []propagatedstorage.Type
+	expected          int
+	falsePositiveRate float64
+
+	rebuildMu sync.Mutex
+
+	mu       sync.RWMutex
+	filters  map[propagatedstorage.Type]*Filter
+	building map[propagatedstorage.Type]*Filter
+}
+
+// Option configures optional behaviour of a bloom filtered datastore.
+type Option func(ds *Datastore)
+
+// WithExpectedItems sets the number of IDs per Type the filters are sized for. Holding more IDs raises
+// the false positive rate.
+func WithExpectedItems(expected int) Option {
+	return func(ds *Datastore) {
+		ds.expected = expected
+	}
+}
+
+// WithFalsePositiveRate sets the rate at which the filters let reads of IDs that are not stored
+// through to the backing datastore.
+func WithFalsePositiveRate(rate float64) Option {
+	return func(ds *Datastore) {
+		ds.falsePositiveRate = rate
+	}
+}
+
+// New returns a datastore filtering reads of types in front of backing, and builds the filters by
+// scanning backing.
+func New(ctx context.Context, backing propagatedstorage.Datastore, types []propagatedstorage.Type, opts ...Option) (*Datastore, error) {
+	ds := &Datastore{
+		backing:           backing,
+		types:             types,
+		expected:          DefaultExpectedItems,
+		falsePositiveRate: DefaultFalsePositiveRate,
+	}
+
+	for _, opt := range opts {
+		opt(ds)
+	}
+
+	if err := ds.Rebuild(ctx); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// Rebuild replaces the filters by new ones built by scanning the backing datastore. Saves made through
+// the datastore while rebuilding are added to the new filters as well. Deletes made meanwhile may be
+// missed, which only ever costs extra reads.
+func (ds *Datastore) Rebuild(ctx context.Context) error {
+	ds.rebuildMu.Lock()
+	defer ds.rebuildMu.Unlock()
+
+	filters := make(map[propagatedstorage.Type]*Filter, len(ds.types))
+	for _, itemType := range ds.types {
+		filters[itemType] = NewFilter(ds.expected, ds.falsePositiveRate)
+	}
+
+	ds.mu.Lock()
+	ds.building = filters
+	ds.mu.Unlock()
+
+	for itemType, filter := range filters {
+		filter := filter
+		err := propagatedstorage.ScanIDs(ctx, ds.backing, itemType, func(id string) error {
+			filter.Add(id)
+			return nil
+		})
+		if err != nil {
+			ds.mu.Lock()
+			ds.building = nil
+			ds.mu.Unlock()
+			return fmt.Errorf("could not build bloom filter of %s: %w", itemType, err)
+		}
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.filters = filters
+	ds.building = nil
+	return nil
+}
+
+// Get populates model from the backing datastore, unless the filter of its Type knows it is not
+// stored, in which case it fails with propagatedstorage.ErrNotFound.
+func (ds *Datastore) Get(ctx context.Context, model *propagatedstorage.Model) error {
+	if filter := ds.filter(model.Type); filter != nil && !filter.MayContain(model.ID) {
+		e := propagatedstorage.ErrNotFound.Wrap(errors.New("not in bloom filter"))
+		e.Type = model.Type
+		e.ID = model.ID
+		return e
+	}
+	return ds.backing.Get(ctx, model)
+}
+
+// Save adds model to the filter of its Type and saves it to the backing datastore. It is added first,
+// so concurrent reads never skip a model that is being saved. It is added on every save, even if the
+// filter may contain it already: the ID may only collide with others, whose deletes must not remove it.
+func (ds *Datastore) Save(ctx context.Context, model *propagatedstorage.Model) error {
+	ds.mu.RLock()
+	for _, filters := range []map[propagatedstorage.Type]*Filter{ds.filters, ds.building} {
+		if filter := filters[model.Type]; filter != nil {
+			filter.Add(model.ID)
+		}
+	}
+	ds.mu.RUnlock()
+
+	return ds.backing.Save(ctx, model)
+}
+
+// Delete deletes model from the backing datastore and removes it from the filter of its Type.
+//
+// An ID that was never added but collides with the deleted one may be removed from the filter with
+// it. A read of such an ID goes to the fallback service, whose answer is written back and adds it to
+// the filter again.
+func (ds *Datastore) Delete(ctx context.Context, model *propagatedstorage.Model) error {
+	if err := propagatedstorage.Delete(ctx, ds.backing, model); err != nil {
+		return err
+	}
+
+	if filter := ds.filter(model.Type); filter != nil && filter.MayContain(model.ID) {
+		filter.Remove(model.ID)
+	}
+	return nil
+}
+
+// Close closes the backing datastore.
+func (ds *Datastore) Close(ctx context.Context) error {
+	return propagatedstorage.CloseAll(ctx, ds.backing)
+}
+
+// ScanIDs scans the IDs stored in the backing datastore.
+func (ds *Datastore) ScanIDs(ctx context.Context, itemType propagatedstorage.Type, fn func(id string) error) error {
+	return propagatedstorage.ScanIDs(ctx, ds.backing, itemType, fn)
+}
+
+// List lists the models stored in the backing datastore.
+func (ds *Datastore) List(ctx context.Context, itemType propagatedstorage.Type, filter propagatedstorage.ListFilter, pageToken string) (*propagatedstorage.Page, error) {
+	return propagatedstorage.List(ctx, ds.backing, itemType, filter, pageToken)
+}
+
+// ChangedSince lists the models changed in the backing datastore.
+func (ds *Datastore) ChangedSince(ctx context.Context, itemType propagatedstorage.Type, since time.Time, cursor string) (*propagatedstorage.Changes, error) {
+	return propagatedstorage.ChangedSince(ctx, ds.backing, itemType, since, cursor)
+}
+
+func (ds *Datastore) filter(itemType propagatedstorage.Type) *Filter {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	return ds.filters[itemType]
+}
@@ -0,0 +1,228 @@
+package bloom_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/bloom"
+	"github.com/Tanax/propagatedstorage/datastoretest"
+	"github.com/Tanax/propagatedstorage/memstore"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testType propagatedstorage.Type = "TestType"
+
+// countingDatastore returns a memstore datastore counting the reads that reach it.
+func countingDatastore(backing *memstore.Datastore, reads *int64) propagatedstorage.Datastore {
+	return propagatedstorage.InterceptDatastore(backing, func(ctx context.Context, call *propagatedstorage.Call, next propagatedstorage.Handler) error {
+		if call.Operation == propagatedstorage.OperationDatastoreGet {
+			atomic.AddInt64(reads, 1)
+		}
+		return next(ctx, call)
+	})
+}
+
+func save(t *testing.T, ds propagatedstorage.Datastore, id string) {
+	model := propagatedstorage.NewModel(id, testType, 1)
+	model.Item = propagatedstoragetest.NewItem(testType, id, 1, "Heyhey")
+	require.Nil(t, ds.Save(context.TODO(), model))
+}
+
+func TestConformance(t *testing.T) {
+	datastoretest.RunConformanceTests(t, func(t *testing.T) propagatedstorage.Datastore {
+		ds, err := bloom.New(context.TODO(), memstore.New(), []propagatedstorage.Type{datastoretest.Type, datastoretest.OtherType})
+		require.Nil(t, err)
+		return ds
+	})
+}
+
+func TestNew_BuildsFromScan(t *testing.T) {
+	// Setup
+	backing := memstore.New()
+	save(t, backing, "stored")
+
+	// Apply
+	ds, err := bloom.New(context.TODO(), backing, []propagatedstorage.Type{testType})
+
+	// Assert
+	require.Nil(t, err)
+	model := propagatedstorage.NewModel("stored", testType, 0)
+	assert.Nil(t, ds.Get(context.TODO(), model))
+	assert.Equal(t, 1, model.Version)
+}
+
+func TestNew_Unsupported(t *testing.T) {
+	// Apply
+	_, err := bloom.New(context.TODO(), struct{ propagatedstorage.Datastore }{memstore.New()}, []propagatedstorage.Type{testType})
+
+	// Assert
+	assert.True(t, errors.Is(err, propagatedstorage.ErrUnsupported))
+}
+
+func TestGet_SkipsDefiniteMisses(t *testing.T) {
+	// Setup
+	var (
+		reads   int64
+		backing = memstore.New()
+	)
+	save(t, backing, "stored")
+	ds, err := bloom.New(context.TODO(), countingDatastore(backing, &reads), []propagatedstorage.Type{testType})
+	require.Nil(t, err)
+
+	// Apply
+	var missing int
+	for i := 0; i < 1000; i++ {
+		err := ds.Get(context.TODO(), propagatedstorage.NewModel(fmt.Sprintf("unknown-%d", i), testType, 0))
+		if errors.Is(err, propagatedstorage.ErrNotFound) {
+			missing++
+		}
+	}
+	untyped := ds.Get(context.TODO(), propagatedstorage.NewModel("stored", "UnfilteredType", 0))
+
+	// Assert
+	assert.Equal(t, 1000, missing)
+	assert.True(t, errors.Is(untyped, propagatedstorage.ErrNotFound))
+	assert.Less(t, atomic.LoadInt64(&reads), int64(50), "only false positives and unfiltered Types may reach the backing datastore")
+}
+
+func TestSaveAndDelete_MaintainFilter(t *testing.T) {
+	// Setup
+	var (
+		reads   int64
+		backing = memstore.New()
+	)
+	ds, err := bloom.New(context.TODO(), countingDatastore(backing, &reads), []propagatedstorage.Type{testType})
+	require.Nil(t, err)
+
+	// Apply
+	save(t, ds, "ThisIsMyID")
+	saved := ds.Get(context.TODO(), propagatedstorage.NewModel("ThisIsMyID", testType, 0))
+	deleteErr := propagatedstorage.Delete(context.TODO(), ds, propagatedstorage.NewModel("ThisIsMyID", testType, 0))
+	readsBefore := atomic.LoadInt64(&reads)
+	deleted := ds.Get(context.TODO(), propagatedstorage.NewModel("ThisIsMyID", testType, 0))
+
+	// Assert
+	assert.Nil(t, saved)
+	assert.Nil(t, deleteErr)
+	assert.True(t, errors.Is(deleted, propagatedstorage.ErrNotFound))
+	assert.Equal(t, readsBefore, atomic.LoadInt64(&reads), "a deleted ID must be skipped")
+}
+
+func TestSave_CountsCollidingIDs(t *testing.T) {
+	// Setup
+	ds, err := bloom.New(context.TODO(), memstore.New(), []propagatedstorage.Type{testType}, bloom.WithExpectedItems(1), bloom.WithFalsePositiveRate(0.5))
+	require.Nil(t, err)
+	save(t, ds, "ThisIsMyID")
+
+	// A filter sized like that of the datastore tells which IDs collide with the saved one.
+	filter := bloom.NewFilter(1, 0.5)
+	filter.Add("ThisIsMyID")
+	colliding := ""
+	for i := 0; colliding == ""; i++ {
+		if id := fmt.Sprintf("colliding-%d", i); filter.MayContain(id) {
+			colliding = id
+		}
+	}
+
+	// Apply
+	save(t, ds, colliding)
+	deleteErr := propagatedstorage.Delete(context.TODO(), ds, propagatedstorage.NewModel("ThisIsMyID", testType, 0))
+	getErr := ds.Get(context.TODO(), propagatedstorage.NewModel(colliding, testType, 0))
+
+	// Assert
+	assert.Nil(t, deleteErr)
+	assert.Nil(t, getErr, "deleting an ID must not drop the saved IDs colliding with it")
+}
+
+// blockingScanner blocks scans once they are done until release is closed, if scanned is set.
+type blockingScanner struct {
+	*memstore.Datastore
+	scanned chan struct{}
+	release chan struct{}
+}
+
+func (ds *blockingScanner) ScanIDs(ctx context.Context, itemType propagatedstorage.Type, fn func(id string) error) error {
+	if err := ds.Datastore.ScanIDs(ctx, itemType, fn); err != nil {
+		return err
+	}
+	if ds.scanned != nil {
+		ds.scanned <- struct{}{}
+		<-ds.release
+	}
+	return nil
+}
+
+func TestRebuild_KeepsConcurrentSaves(t *testing.T) {
+	// Setup
+	backing := &blockingScanner{Datastore: memstore.New()}
+	ds, err := bloom.New(context.TODO(), backing, []propagatedstorage.Type{testType})
+	require.Nil(t, err)
+	backing.scanned = make(chan struct{})
+	backing.release = make(chan struct{})
+
+	// Apply
+	rebuilt := make(chan error)
+	go func() { rebuilt <- ds.Rebuild(context.TODO()) }()
+	<-backing.scanned
+	save(t, ds, "ThisIsMyID")
+	close(backing.release)
+	rebuildErr := <-rebuilt
+	getErr := ds.Get(context.TODO(), propagatedstorage.NewModel("ThisIsMyID", testType, 0))
+
+	// Assert
+	assert.Nil(t, rebuildErr)
+	assert.Nil(t, getErr, "a model saved while rebuilding must be in the new filter")
+}
+
+func TestService_FallbackOnDefiniteMiss(t *testing.T) {
+	// Setup
+	var (
+		ctx      = context.TODO()
+		reads    int64
+		fallback = propagatedstoragetest.NewFakeService()
+	)
+	ds, err := bloom.New(ctx, countingDatastore(memstore.New(), &reads), []propagatedstorage.Type{testType})
+	require.Nil(t, err)
+	fallback.SetItem(propagatedstoragetest.NewItem(testType, "ThisIsMyID", 1, "from owner"))
+	service := propagatedstorage.NewService(ds, testType, 0, fallback)
+
+	// Apply
+	item := propagatedstoragetest.NewItem(testType, "ThisIsMyID", 0, "")
+	first := service.Get(ctx, item)
+	second := service.Get(ctx, propagatedstoragetest.NewItem(testType, "ThisIsMyID", 0, ""))
+
+	// Assert
+	assert.Nil(t, first)
+	assert.Nil(t, second)
+	assert.Equal(t, "from owner", item.Payload)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&reads), "only the read after the write back may reach the datastore")
+	assert.Len(t, fallback.Calls(), 1)
+}
+
+func TestFilter_FalsePositiveRate(t *testing.T) {
+	// Setup
+	filter := bloom.NewFilter(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		filter.Add(fmt.Sprintf("added-%d", i))
+	}
+
+	// Apply
+	var falsePositives int
+	for i := 0; i < 10000; i++ {
+		if filter.MayContain(fmt.Sprintf("other-%d", i)) {
+			falsePositives++
+		}
+	}
+
+	// Assert
+	for i := 0; i < 10000; i++ {
+		require.True(t, filter.MayContain(fmt.Sprintf("added-%d", i)), "added IDs must never be missing")
+	}
+	assert.Less(t, falsePositives, 200)
+}
@@ -0,0 +1,90 @@
+package bloom
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// Filter is a counting bloom filter of IDs. It never reports an added ID as missing unless it was
+// removed since, and reports an ID that was never added as present with roughly the false positive
+// rate it was sized for. It is safe for concurrent use.
+type Filter struct {
+	mu       sync.RWMutex
+	counters []uint8
+	hashes   int
+}
+
+// NewFilter returns an empty filter sized to hold expected IDs at falsePositiveRate.
+func NewFilter(expected int, falsePositiveRate float64) *Filter {
+	if expected < 1 {
+		expected = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = DefaultFalsePositiveRate
+	}
+
+	size := int(math.Ceil(-float64(expected) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashes := int(math.Round(float64(size) / float64(expected) * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+
+	return &Filter{
+		counters: make([]uint8, size),
+		hashes:   hashes,
+	}
+}
+
+// Add adds id to the filter.
+func (f *Filter) Add(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.each(id, func(i uint64) {
+		// A saturated counter has lost count, so it stays saturated rather than risk dropping to zero.
+		if f.counters[i] < math.MaxUint8 {
+			f.counters[i]++
+		}
+	})
+}
+
+// Remove removes id from the filter. Only IDs that were added may be removed, otherwise other IDs
+// may go missing.
+func (f *Filter) Remove(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.each(id, func(i uint64) {
+		if c := f.counters[i]; c > 0 && c < math.MaxUint8 {
+			f.counters[i]--
+		}
+	})
+}
+
+// MayContain reports whether id may have been added. A false result is definite.
+func (f *Filter) MayContain(id string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	contains := true
+	f.each(id, func(i uint64) {
+		if f.counters[i] == 0 {
+			contains = false
+		}
+	})
+	return contains
+}
+
+// each calls fn with the counter indexes of id, derived from a single 64 bit hash by double hashing.
+func (f *Filter) each(id string, fn func(i uint64)) {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	sum := h.Sum64()
+
+	h1, h2 := sum&math.MaxUint32, sum>>32
+	size := uint64(len(f.counters))
+	for i := 0; i < f.hashes; i++ {
+		fn((h1 + uint64(i)*h2) % size)
+	}
+}
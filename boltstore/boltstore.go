@@ -0,0 +1,214 @@
+// Package boltstore provides a propagated storage datastore persisted to a single local file with
+// bbolt, for small services and command-line tools. Every Type is stored in a bucket of its own, keyed
+// by ID, with the item serialized by a propagatedstorage.Codec.
+package boltstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	bolt "go.etcd.io/bbolt"
+)
+
+// record is how a model is stored in its bucket.
+type record struct {
+	Version  int
+	Item     []byte
+	Created  time.Time
+	Modified time.Time
+	Expires  time.Time
+}
+
+// Datastore is a propagated storage datastore backed by a bbolt database. Any number of readers may
+// use it concurrently with a single writer; every save is synced to disk before it returns.
+type Datastore struct {
+	db    *bolt.DB
+	codec propagatedstorage.Codec
+}
+
+// Open opens, or creates, the database file at path and returns a datastore on top of it. codec must
+// be able to decode every Type that is stored.
+func Open(path string, codec propagatedstorage.Codec) (*Datastore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database %s: %w", path, propagatedstorage.ErrInitiateDatastoreDriver.Wrap(err))
+	}
+
+	return New(db, codec), nil
+}
+
+// New returns a datastore on top of an open bbolt database.
+func New(db *bolt.DB, codec propagatedstorage.Codec) *Datastore {
+	return &Datastore{
+		db:    db,
+		codec: codec,
+	}
+}
+
+// Get populates model with the stored model of the same Type and ID.
+func (ds *Datastore) Get(ctx context.Context, model *propagatedstorage.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var data []byte
+	err := ds.db.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket([]byte(model.Type)); bucket != nil {
+			// Values are only valid within the transaction.
+			if value := bucket.Get([]byte(model.ID)); value != nil {
+				data = append([]byte(nil), value...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		e := propagatedstorage.ErrNotFound.Wrap(nil)
+		e.Type = model.Type
+		e.ID = model.ID
+		return e
+	}
+
+	return ds.decode(model.Type, model.ID, data, model)
+}
+
+// Save stores model in the bucket of its Type, replacing any model of the same ID.
+func (ds *Datastore) Save(ctx context.Context, model *propagatedstorage.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	item, err := ds.codec.Marshal(model.Item)
+	if err != nil {
+		return fmt.Errorf("could not encode item: %w", err)
+	}
+
+	data, err := json.Marshal(record{
+		Version:  model.Version,
+		Item:     item,
+		Created:  model.Created,
+		Modified: model.Modified,
+		Expires:  model.Expires,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ds.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(model.Type))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(model.ID), data)
+	})
+}
+
+// Delete removes the stored model of the same Type and ID as model.
+func (ds *Datastore) Delete(ctx context.Context, model *propagatedstorage.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return ds.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(model.Type))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete([]byte(model.ID))
+	})
+}
+
+// Types returns every Type that has a bucket, in byte order.
+func (ds *Datastore) Types(ctx context.Context) ([]propagatedstorage.Type, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var types []propagatedstorage.Type
+	err := ds.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			types = append(types, propagatedstorage.Type(name))
+			return nil
+		})
+	})
+
+	return types, err
+}
+
+// ForEach calls fn for every stored model of itemType, in ID byte order, for instance to export them.
+// The iteration runs in a single read transaction, so it sees a consistent snapshot and does not
+// block writers. It stops at the first error returned by fn or when ctx is done.
+//
+// fn must not write to the datastore: a write that grows the file waits for the read transaction to
+// end, which deadlocks. Callers that resync models collect them first and save them once ForEach
+// returns.
+func (ds *Datastore) ForEach(ctx context.Context, itemType propagatedstorage.Type, fn func(model *propagatedstorage.Model) error) error {
+	return ds.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(itemType))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(key, value []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			model := propagatedstorage.NewModel(string(key), itemType, 0)
+			if err := ds.decode(itemType, model.ID, value, model); err != nil {
+				return err
+			}
+			return fn(model)
+		})
+	})
+}
+
+// ScanIDs calls fn with the ID of every stored model of itemType, in ID byte order, without decoding
+// the models. Like ForEach, it runs in a single read transaction, so fn must not write to the
+// datastore.
+func (ds *Datastore) ScanIDs(ctx context.Context, itemType propagatedstorage.Type, fn func(id string) error) error {
+	return ds.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(itemType))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(key, _ []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fn(string(key))
+		})
+	})
+}
+
+// Close closes the underlying database. Closing it again does nothing.
+func (ds *Datastore) Close(ctx context.Context) error {
+	return ds.db.Close()
+}
+
+func (ds *Datastore) decode(itemType propagatedstorage.Type, id string, data []byte, model *propagatedstorage.Model) error {
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return fmt.Errorf("could not decode %s %s: %w", itemType, id, err)
+	}
+
+	item, err := ds.codec.Unmarshal(itemType, r.Item)
+	if err != nil {
+		return err
+	}
+
+	model.Version = r.Version
+	model.Item = item
+	model.Created = r.Created
+	model.Modified = r.Modified
+	model.Expires = r.Expires
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package boltstore_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/boltstore"
+	"github.com/Tanax/propagatedstorage/datastoretest"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCodec() *propagatedstorage.JSONCodec {
+	codec := propagatedstorage.NewJSONCodec()
+	for _, itemType := range []propagatedstorage.Type{datastoretest.Type, datastoretest.OtherType} {
+		codec.Register(itemType, func() propagatedstorage.Item { return new(propagatedstoragetest.Item) })
+	}
+	return codec
+}
+
+func newDatastore(t *testing.T, path string) *boltstore.Datastore {
+	datastore, err := boltstore.Open(path, newCodec())
+	require.Nil(t, err)
+	t.Cleanup(func() { datastore.Close(context.Background()) })
+
+	return datastore
+}
+
+func TestConformance(t *testing.T) {
+	datastoretest.RunConformanceTests(t, func(t *testing.T) propagatedstorage.Datastore {
+		return newDatastore(t, filepath.Join(t.TempDir(), "propagatedstorage.db"))
+	})
+}
+
+func TestSave_Durable(t *testing.T) {
+	// Setup
+	var (
+		ctx   = context.TODO()
+		path  = filepath.Join(t.TempDir(), "propagatedstorage.db")
+		saved = propagatedstorage.NewModel("ThisIsMyID", datastoretest.Type, 1)
+	)
+	saved.Item = propagatedstoragetest.NewItem(datastoretest.Type, "ThisIsMyID", 1, "Heyhey")
+
+	// Apply
+	datastore, err := boltstore.Open(path, newCodec())
+	require.Nil(t, err)
+	require.Nil(t, datastore.Save(ctx, saved))
+	require.Nil(t, datastore.Close(context.TODO()))
+
+	reopened := newDatastore(t, path)
+	model := propagatedstorage.NewModel("ThisIsMyID", datastoretest.Type, 0)
+	err = reopened.Get(ctx, model)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, saved.Item, model.Item)
+}
+
+func TestForEach_ConcurrentReaders(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		datastore = newDatastore(t, filepath.Join(t.TempDir(), "propagatedstorage.db"))
+		wg        sync.WaitGroup
+	)
+
+	for i := 0; i < 10; i++ {
+		model := propagatedstorage.NewModel(fmt.Sprintf("ID%d", i), datastoretest.Type, i)
+		model.Item = propagatedstoragetest.NewItem(datastoretest.Type, model.ID, i, "")
+		require.Nil(t, datastore.Save(ctx, model))
+	}
+	require.Nil(t, datastore.Save(ctx, propagatedstorage.NewModel("ID0", datastoretest.OtherType, 1)))
+
+	// Apply
+	counts := make([]int, 5)
+	for r := range counts {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			assert.Nil(t, datastore.ForEach(ctx, datastoretest.Type, func(model *propagatedstorage.Model) error {
+				assert.Equal(t, model.ID, model.Item.GetID())
+				counts[r]++
+				return nil
+			}))
+		}(r)
+	}
+	wg.Wait()
+
+	types, err := datastore.Types(ctx)
+
+	// Assert
+	assert.Equal(t, []int{10, 10, 10, 10, 10}, counts)
+	assert.Nil(t, err)
+	assert.Equal(t, []propagatedstorage.Type{datastoretest.Type, datastoretest.OtherType}, types)
+}
+
+func TestOpenDatastore_FileURL(t *testing.T) {
+	// Setup
+	path := filepath.Join(t.TempDir(), "propagatedstorage.db")
+
+	// Apply
+	datastore, err := propagatedstorage.OpenDatastore(context.TODO(), "file://"+path)
+
+	// Assert
+	require.Nil(t, err)
+	assert.IsType(t, &boltstore.Datastore{}, datastore)
+	assert.Nil(t, propagatedstorage.CloseAll(context.TODO(), datastore))
+	assert.FileExists(t, path)
+}
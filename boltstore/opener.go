@@ -0,0 +1,38 @@
+package boltstore
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/Tanax/propagatedstorage"
+)
+
+// Scheme is the URL scheme boltstore registers on propagatedstorage.DefaultURLMux.
+const Scheme = "file"
+
+func init() {
+	propagatedstorage.DefaultURLMux().RegisterDatastore(Scheme, &URLOpener{})
+}
+
+// URLOpener opens the database file at the path of "file:///path/to/file.db" URLs.
+type URLOpener struct {
+	// Codec serializes the stored items. Defaults to propagatedstorage.DefaultCodec.
+	Codec propagatedstorage.Codec
+}
+
+// OpenDatastoreURL opens, or creates, the database file at the path of u. The URL takes no parameters.
+func (o *URLOpener) OpenDatastoreURL(ctx context.Context, u *url.URL) (propagatedstorage.Datastore, error) {
+	if err := propagatedstorage.CheckURLParams(u); err != nil {
+		return nil, err
+	}
+	if u.Path == "" {
+		return nil, errors.New("missing path of the database file")
+	}
+
+	codec := o.Codec
+	if codec == nil {
+		codec = propagatedstorage.DefaultCodec
+	}
+	return Open(u.Path, codec)
+}
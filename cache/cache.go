@@ -0,0 +1,388 @@
+// Package cache provides a tiered propagated storage datastore that keeps a bounded, in-process LRU
+// cache in front of another datastore, such as the DynamoDB one.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+)
+
+// DefaultMaxEntries is the number of models cached unless WithMaxEntries says otherwise.
+const DefaultMaxEntries = 10000
+
+// Sizer returns the size of a model in bytes, as counted against the limit set by WithMaxBytes.
+type Sizer func(model *propagatedstorage.Model) int
+
+// JSONSizer sizes a model by the length of its item encoded as JSON.
+func JSONSizer(model *propagatedstorage.Model) int {
+	data, err := json.Marshal(model.Item)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// Stats are the counters of a cache.
+type Stats struct {
+	Hits        int64
+	Misses      int64
+	Evictions   int64
+	Expirations int64
+	Entries     int
+	Bytes       int
+}
+
+type key struct {
+	itemType propagatedstorage.Type
+	id       string
+}
+
+type entry struct {
+	key     key
+	model   propagatedstorage.Model
+	size    int
+	expires time.Time
+}
+
+// load tracks the reads of a model from the backing datastore that are underway.
+type load struct {
+	readers int
+	// writes counts the writes of the model to the cache since the first of the reads started.
+	writes int
+}
+
+// Datastore is a datastore that reads through and writes through an LRU cache in front of another
+// datastore. Items that are propagatedstorage.Cloners are copied as they are cached
+// and handed out, so readers can change their item without changing the cached one; other items are
+// shared between readers. It is safe for concurrent use.
+type Datastore struct {
+	backing    propagatedstorage.Datastore
+	maxEntries int
+	maxBytes   int
+	sizer      Sizer
+	ttl        time.Duration
+	typeTTLs   map[propagatedstorage.Type]time.Duration
+	now        func() time.Time
+	refresh    bool
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[key]*list.Element
+	loads   map[key]*load
+	bytes   int
+	stats   Stats
+}
+
+// Option configures optional behaviour of a cache.
+type Option func(ds *Datastore)
+
+// WithMaxEntries limits the number of cached models. Nothing is cached if max is zero or less.
+func WithMaxEntries(max int) Option {
+	return func(ds *Datastore) {
+		if max < 0 {
+			max = 0
+		}
+		ds.maxEntries = max
+	}
+}
+
+// WithMaxBytes limits the total size of the cached models, as measured by sizer.
+func WithMaxBytes(max int, sizer Sizer) Option {
+	return func(ds *Datastore) {
+		ds.maxBytes = max
+		ds.sizer = sizer
+	}
+}
+
+// WithTTL sets how long models are cached. Models are cached until evicted if it is zero. Models
+// are never cached past their own expiry.
+func WithTTL(ttl time.Duration) Option {
+	return func(ds *Datastore) {
+		ds.ttl = ttl
+	}
+}
+
+// WithTypeTTL sets how long models of itemType are cached, overriding WithTTL.
+func WithTypeTTL(itemType propagatedstorage.Type, ttl time.Duration) Option {
+	return func(ds *Datastore) {
+		ds.typeTTLs[itemType] = ttl
+	}
+}
+
+// WithClock sets the clock used to expire models. Defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(ds *Datastore) {
+		ds.now = now
+	}
+}
+
+// WithRefreshOnInvalidate makes Invalidate read invalidated models from the backing datastore again
+// right away, instead of evicting them until they are next read.
+func WithRefreshOnInvalidate() Option {
+	return func(ds *Datastore) {
+		ds.refresh = true
+	}
+}
+
+// New returns a cache in front of backing.
+func New(backing propagatedstorage.Datastore, opts ...Option) *Datastore {
+	ds := &Datastore{
+		backing:    backing,
+		maxEntries: DefaultMaxEntries,
+		typeTTLs:   make(map[propagatedstorage.Type]time.Duration),
+		now:        time.Now,
+		lru:        list.New(),
+		entries:    make(map[key]*list.Element),
+		loads:      make(map[key]*load),
+	}
+
+	for _, opt := range opts {
+		opt(ds)
+	}
+
+	return ds
+}
+
+// Get populates model from the cache, or from the backing datastore when it is not cached, caching it
+// from then on. The model is not cached if it was saved, invalidated or deleted while it was read, as
+// what was read may be older than that.
+func (ds *Datastore) Get(ctx context.Context, model *propagatedstorage.Model) error {
+	if ds.get(model) {
+		return nil
+	}
+
+	k := key{model.Type, model.ID}
+	writes := ds.startLoad(k)
+	if err := ds.backing.Get(ctx, model); err != nil {
+		ds.endLoad(k, writes, nil)
+		return err
+	}
+
+	ds.endLoad(k, writes, model)
+	return nil
+}
+
+// Save saves model to the backing datastore and caches it once that succeeded.
+func (ds *Datastore) Save(ctx context.Context, model *propagatedstorage.Model) error {
+	if err := ds.backing.Save(ctx, model); err != nil {
+		// The backing datastore may or may not hold the model now; make sure the next read asks it.
+		ds.remove(key{model.Type, model.ID})
+		return err
+	}
+
+	ds.put(model)
+	return nil
+}
+
+// Delete deletes model from the backing datastore and evicts it from the cache.
+func (ds *Datastore) Delete(ctx context.Context, model *propagatedstorage.Model) error {
+	defer ds.remove(key{model.Type, model.ID})
+
+	return propagatedstorage.Delete(ctx, ds.backing, model)
+}
+
+// Close closes the backing datastore.
+func (ds *Datastore) Close(ctx context.Context) error {
+	return propagatedstorage.CloseAll(ctx, ds.backing)
+}
+
+// ScanIDs scans the IDs stored in the backing datastore, which must be a propagatedstorage.IDScanner.
+func (ds *Datastore) ScanIDs(ctx context.Context, itemType propagatedstorage.Type, fn func(id string) error) error {
+	return propagatedstorage.ScanIDs(ctx, ds.backing, itemType, fn)
+}
+
+// List lists the models stored in the backing datastore, which must be a propagatedstorage.Lister.
+// Listed models are not cached.
+func (ds *Datastore) List(ctx context.Context, itemType propagatedstorage.Type, filter propagatedstorage.ListFilter, pageToken string) (*propagatedstorage.Page, error) {
+	return propagatedstorage.List(ctx, ds.backing, itemType, filter, pageToken)
+}
+
+// ChangedSince lists the models changed in the backing datastore, which must be a
+// propagatedstorage.ChangeLister. Listed models are not cached.
+func (ds *Datastore) ChangedSince(ctx context.Context, itemType propagatedstorage.Type, since time.Time, cursor string) (*propagatedstorage.Changes, error) {
+	return propagatedstorage.ChangedSince(ctx, ds.backing, itemType, since, cursor)
+}
+
+// Invalidate evicts the cached model of itemType and id, or reads it from the backing datastore again
+// if the cache refreshes on invalidation. Models that are not cached are left alone.
+func (ds *Datastore) Invalidate(ctx context.Context, itemType propagatedstorage.Type, id string) error {
+	if !ds.remove(key{itemType, id}) || !ds.refresh {
+		return nil
+	}
+
+	model := propagatedstorage.NewModel(id, itemType, 0)
+	if err := ds.backing.Get(ctx, model); err != nil {
+		if errors.Is(err, propagatedstorage.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	ds.put(model)
+	return nil
+}
+
+// Stats returns the current counters of the cache.
+func (ds *Datastore) Stats() Stats {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	stats := ds.stats
+	stats.Entries = ds.lru.Len()
+	stats.Bytes = ds.bytes
+
+	return stats
+}
+
+func (ds *Datastore) get(model *propagatedstorage.Model) bool {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	element, ok := ds.entries[key{model.Type, model.ID}]
+	if !ok {
+		ds.stats.Misses++
+		return false
+	}
+
+	e := element.Value.(*entry)
+	if !e.expires.IsZero() && !ds.now().Before(e.expires) {
+		ds.removeElement(element)
+		ds.stats.Expirations++
+		ds.stats.Misses++
+		return false
+	}
+
+	ds.lru.MoveToFront(element)
+	ds.stats.Hits++
+	*model = e.model
+	model.Item = clone(e.model.Item)
+
+	return true
+}
+
+// startLoad records that the model of k is read from the backing datastore and returns the writes of
+// it so far, for endLoad.
+func (ds *Datastore) startLoad(k key) int {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	l, ok := ds.loads[k]
+	if !ok {
+		l = new(load)
+		ds.loads[k] = l
+	}
+	l.readers++
+	return l.writes
+}
+
+// endLoad records that a read of the model of k started by startLoad ended, and caches model, the
+// model read if any, unless the model of k was written to the cache meanwhile.
+func (ds *Datastore) endLoad(k key, writes int, model *propagatedstorage.Model) {
+	size := 0
+	if model != nil {
+		size = ds.size(model)
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	l := ds.loads[k]
+	if l.readers--; l.readers == 0 {
+		delete(ds.loads, k)
+	}
+	if model != nil && l.writes == writes {
+		ds.store(k, model, size)
+	}
+}
+
+// written records a write of the model of k to the cache. The caller must hold the lock.
+func (ds *Datastore) written(k key) {
+	if l, ok := ds.loads[k]; ok {
+		l.writes++
+	}
+}
+
+// put caches model as it was saved or refreshed.
+func (ds *Datastore) put(model *propagatedstorage.Model) {
+	k := key{model.Type, model.ID}
+	size := ds.size(model)
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.written(k)
+	ds.store(k, model, size)
+}
+
+func (ds *Datastore) size(model *propagatedstorage.Model) int {
+	if ds.sizer == nil {
+		return 0
+	}
+	return ds.sizer(model)
+}
+
+// store caches model, replacing the cached model of k. The caller must hold the lock.
+func (ds *Datastore) store(k key, model *propagatedstorage.Model, size int) {
+	if element, ok := ds.entries[k]; ok {
+		ds.removeElement(element)
+	}
+
+	if ds.maxBytes > 0 && size > ds.maxBytes {
+		return
+	}
+
+	e := &entry{key: k, model: *model, size: size}
+	e.model.Item = clone(model.Item)
+	ttl, ok := ds.typeTTLs[model.Type]
+	if !ok {
+		ttl = ds.ttl
+	}
+	if ttl > 0 {
+		e.expires = ds.now().Add(ttl)
+	}
+	if !model.Expires.IsZero() && (e.expires.IsZero() || model.Expires.Before(e.expires)) {
+		e.expires = model.Expires
+	}
+
+	ds.entries[k] = ds.lru.PushFront(e)
+	ds.bytes += size
+
+	for ds.lru.Len() > 0 && (ds.lru.Len() > ds.maxEntries || (ds.maxBytes > 0 && ds.bytes > ds.maxBytes)) {
+		ds.removeElement(ds.lru.Back())
+		ds.stats.Evictions++
+	}
+}
+
+// remove removes the model of k from the cache and reports whether it was cached.
+func (ds *Datastore) remove(k key) bool {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.written(k)
+
+	element, ok := ds.entries[k]
+	if ok {
+		ds.removeElement(element)
+	}
+	return ok
+}
+
+// removeElement removes an element from the cache. The caller must hold the lock.
+func (ds *Datastore) removeElement(element *list.Element) {
+	e := ds.lru.Remove(element).(*entry)
+	delete(ds.entries, e.key)
+	ds.bytes -= e.size
+}
+
+func clone(item propagatedstorage.Item) propagatedstorage.Item {
+	if cloner, ok := item.(propagatedstorage.Cloner); ok {
+		return cloner.Clone()
+	}
+	return item
+}
@@ -0,0 +1,295 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/cache"
+	"github.com/Tanax/propagatedstorage/datastoretest"
+	"github.com/Tanax/propagatedstorage/memstore"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testType propagatedstorage.Type = "TestType"
+
+// countingDatastore returns a memstore datastore counting the reads that reach it.
+func countingDatastore(reads *int64) propagatedstorage.Datastore {
+	return propagatedstorage.InterceptDatastore(memstore.New(), func(ctx context.Context, call *propagatedstorage.Call, next propagatedstorage.Handler) error {
+		if call.Operation == propagatedstorage.OperationDatastoreGet {
+			atomic.AddInt64(reads, 1)
+		}
+		return next(ctx, call)
+	})
+}
+
+func save(t *testing.T, ds propagatedstorage.Datastore, itemType propagatedstorage.Type, id string, payload string) {
+	model := propagatedstorage.NewModel(id, itemType, 1)
+	model.Item = propagatedstoragetest.NewItem(itemType, id, 1, payload)
+	require.Nil(t, ds.Save(context.TODO(), model))
+}
+
+func get(ds propagatedstorage.Datastore, itemType propagatedstorage.Type, id string) (*propagatedstorage.Model, error) {
+	model := propagatedstorage.NewModel(id, itemType, 0)
+	return model, ds.Get(context.TODO(), model)
+}
+
+func TestConformance(t *testing.T) {
+	datastoretest.RunConformanceTests(t, func(t *testing.T) propagatedstorage.Datastore {
+		return cache.New(memstore.New())
+	})
+}
+
+func TestGet_ReadThrough(t *testing.T) {
+	// Setup
+	var (
+		reads   int64
+		backing = countingDatastore(&reads)
+		cached  = cache.New(backing)
+	)
+	save(t, backing, testType, "ThisIsMyID", "Heyhey")
+
+	// Apply
+	first, firstErr := get(cached, testType, "ThisIsMyID")
+	second, secondErr := get(cached, testType, "ThisIsMyID")
+	_, missingErr := get(cached, testType, "Missing")
+
+	// Assert
+	assert.Nil(t, firstErr)
+	assert.Nil(t, secondErr)
+	assert.True(t, errors.Is(missingErr, propagatedstorage.ErrNotFound))
+	assert.Equal(t, first, second)
+	assert.Equal(t, int64(2), reads)
+	assert.Equal(t, cache.Stats{Hits: 1, Misses: 2, Entries: 1}, cached.Stats())
+}
+
+func TestGet_KeepsSavesDuringRead(t *testing.T) {
+	// Setup
+	var (
+		read    = make(chan struct{})
+		release = make(chan struct{})
+		backing = propagatedstorage.InterceptDatastore(memstore.New(), func(ctx context.Context, call *propagatedstorage.Call, next propagatedstorage.Handler) error {
+			err := next(ctx, call)
+			if call.Operation == propagatedstorage.OperationDatastoreGet {
+				close(read)
+				<-release
+			}
+			return err
+		})
+		cached = cache.New(backing)
+	)
+	save(t, backing, testType, "ThisIsMyID", "old")
+
+	// Apply
+	done := make(chan error)
+	go func() {
+		_, err := get(cached, testType, "ThisIsMyID")
+		done <- err
+	}()
+	<-read
+	newer := propagatedstorage.NewModel("ThisIsMyID", testType, 2)
+	newer.Item = propagatedstoragetest.NewItem(testType, "ThisIsMyID", 2, "new")
+	saveErr := cached.Save(context.TODO(), newer)
+	close(release)
+	getErr := <-done
+
+	model, err := get(cached, testType, "ThisIsMyID")
+
+	// Assert
+	assert.Nil(t, saveErr)
+	assert.Nil(t, getErr)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, model.Version)
+	assert.Equal(t, "new", model.Item.(*propagatedstoragetest.Item).Payload, "the read that started before the save must not be cached")
+}
+
+func TestSave_WriteThrough(t *testing.T) {
+	// Setup
+	var (
+		reads   int64
+		backing = countingDatastore(&reads)
+		cached  = cache.New(backing)
+	)
+
+	// Apply
+	save(t, cached, testType, "ThisIsMyID", "Heyhey")
+	model, err := get(cached, testType, "ThisIsMyID")
+	_, backingErr := get(backing, testType, "ThisIsMyID")
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Nil(t, backingErr)
+	assert.Equal(t, "Heyhey", model.Item.(*propagatedstoragetest.Item).Payload)
+	assert.Equal(t, int64(1), reads, "only the direct read should reach the backing datastore")
+}
+
+func TestPut_EvictsLeastRecentlyUsed(t *testing.T) {
+	// Setup
+	var (
+		reads  int64
+		cached = cache.New(countingDatastore(&reads), cache.WithMaxEntries(2))
+	)
+
+	// Apply
+	save(t, cached, testType, "A", "")
+	save(t, cached, testType, "B", "")
+	_, _ = get(cached, testType, "A")
+	save(t, cached, testType, "C", "")
+
+	_, _ = get(cached, testType, "A")
+	_, _ = get(cached, testType, "B")
+
+	// Assert
+	assert.Equal(t, int64(1), reads, "B should have been evicted")
+	assert.Equal(t, int64(2), cached.Stats().Evictions)
+}
+
+func TestPut_NegativeMaxEntries(t *testing.T) {
+	// Setup
+	var (
+		reads  int64
+		cached = cache.New(countingDatastore(&reads), cache.WithMaxEntries(-1))
+	)
+
+	// Apply
+	save(t, cached, testType, "A", "")
+	_, err := get(cached, testType, "A")
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), reads, "nothing is cached without room for entries")
+	assert.Equal(t, 0, cached.Stats().Entries)
+}
+
+func TestGet_CopiesItems(t *testing.T) {
+	// Setup
+	var (
+		cached = cache.New(memstore.New())
+		item   = propagatedstoragetest.NewItem(testType, "ThisIsMyID", 1, "Heyhey")
+		model  = propagatedstorage.NewModel("ThisIsMyID", testType, 1)
+	)
+	model.Item = item
+	require.Nil(t, cached.Save(context.TODO(), model))
+
+	// Apply
+	item.Payload = "changed by the saver"
+	read, readErr := get(cached, testType, "ThisIsMyID")
+	read.Item.(*propagatedstoragetest.Item).Payload = "changed by a reader"
+	again, againErr := get(cached, testType, "ThisIsMyID")
+
+	// Assert
+	assert.Nil(t, readErr)
+	assert.Nil(t, againErr)
+	assert.Equal(t, "Heyhey", again.Item.(*propagatedstoragetest.Item).Payload, "cached items must not be shared")
+}
+
+func TestPut_MaxBytes(t *testing.T) {
+	// Setup
+	var (
+		reads  int64
+		sizer  = func(model *propagatedstorage.Model) int { return len(model.Item.(*propagatedstoragetest.Item).Payload) }
+		cached = cache.New(countingDatastore(&reads), cache.WithMaxBytes(10, sizer))
+	)
+
+	// Apply
+	save(t, cached, testType, "A", "12345")
+	save(t, cached, testType, "B", "12345")
+	save(t, cached, testType, "C", "12345")
+	save(t, cached, testType, "Huge", "12345678901")
+
+	// Assert
+	stats := cached.Stats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, 10, stats.Bytes)
+	assert.Equal(t, int64(1), stats.Evictions)
+
+	_, _ = get(cached, testType, "Huge")
+	assert.Equal(t, int64(1), reads, "items larger than the limit are never cached")
+}
+
+func TestGet_TypeTTL(t *testing.T) {
+	// Setup
+	var (
+		reads  int64
+		now    = time.Now()
+		clock  = func() time.Time { return now }
+		cached = cache.New(countingDatastore(&reads), cache.WithClock(clock), cache.WithTTL(time.Hour), cache.WithTypeTTL("ShortLived", time.Second))
+	)
+	save(t, cached, testType, "A", "")
+	save(t, cached, "ShortLived", "A", "")
+
+	// Apply
+	now = now.Add(2 * time.Second)
+	for _, itemType := range []propagatedstorage.Type{testType, "ShortLived"} {
+		_, err := get(cached, itemType, "A")
+		assert.Nil(t, err, fmt.Sprintf("type %s", itemType))
+	}
+
+	// Assert
+	assert.Equal(t, int64(1), reads, "only the short-lived item should have expired")
+	assert.Equal(t, int64(1), cached.Stats().Expirations)
+}
+
+func TestGet_ModelExpiry(t *testing.T) {
+	// Setup
+	var (
+		reads  int64
+		now    = time.Now()
+		clock  = func() time.Time { return now }
+		cached = cache.New(countingDatastore(&reads), cache.WithClock(clock), cache.WithTTL(time.Hour))
+		model  = propagatedstorage.NewModel("ThisIsMyID", testType, 1)
+	)
+	model.Item = propagatedstoragetest.NewItem(testType, "ThisIsMyID", 1, "")
+	model.Expires = now.Add(time.Second)
+	require.Nil(t, cached.Save(context.TODO(), model))
+
+	// Apply
+	now = now.Add(2 * time.Second)
+	_, _ = get(cached, testType, "ThisIsMyID")
+
+	// Assert
+	assert.Equal(t, int64(1), reads, "models must not be cached past their expiry")
+	assert.Equal(t, int64(1), cached.Stats().Expirations)
+}
+
+func TestInvalidate(t *testing.T) {
+	for _, refresh := range []bool{false, true} {
+		t.Run(fmt.Sprintf("refresh=%t", refresh), func(t *testing.T) {
+			// Setup
+			var opts []cache.Option
+			if refresh {
+				opts = append(opts, cache.WithRefreshOnInvalidate())
+			}
+			var (
+				reads   int64
+				backing = countingDatastore(&reads)
+				cached  = cache.New(backing, opts...)
+			)
+			save(t, cached, testType, "ThisIsMyID", "Heyhey")
+			save(t, backing, testType, "ThisIsMyID", "Changed elsewhere")
+
+			// Apply
+			err := cached.Invalidate(context.TODO(), testType, "ThisIsMyID")
+			uncached := cached.Invalidate(context.TODO(), testType, "NotCached")
+
+			// Assert
+			require.Nil(t, err)
+			require.Nil(t, uncached)
+			if refresh {
+				assert.Equal(t, 1, cached.Stats().Entries, "a refreshed model stays cached")
+			} else {
+				assert.Equal(t, 0, cached.Stats().Entries)
+			}
+			model, err := get(cached, testType, "ThisIsMyID")
+			require.Nil(t, err)
+			assert.Equal(t, "Changed elsewhere", model.Item.(*propagatedstoragetest.Item).Payload)
+			assert.Equal(t, int64(1), atomic.LoadInt64(&reads), "invalidating a model that is not cached must not read it")
+		})
+	}
+}
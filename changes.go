@@ -0,0 +1,101 @@
+package propagatedstorage
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Watermark is a position in the order of models by Modified and then ID, up to which changes have
+// been processed. The cursors of ChangedSince are encoded watermarks.
+type Watermark struct {
+	Modified time.Time
+	ID       string
+}
+
+// ParseCursor decodes a cursor returned by ChangedSince. Malformed cursors fail with
+// ErrInvalidPageToken.
+func ParseCursor(cursor string) (Watermark, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return Watermark{}, ErrInvalidPageToken.Wrap(err)
+	}
+
+	parts := strings.SplitN(string(data), "|", 2)
+	if len(parts) != 2 {
+		return Watermark{}, ErrInvalidPageToken.Wrap(errors.New("cursor is not a watermark"))
+	}
+	modified, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return Watermark{}, ErrInvalidPageToken.Wrap(err)
+	}
+
+	return Watermark{Modified: modified, ID: parts[1]}, nil
+}
+
+// Cursor encodes the watermark as a cursor of ChangedSince.
+func (w Watermark) Cursor() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(w.Modified.UTC().Format(time.RFC3339Nano) + "|" + w.ID))
+}
+
+// Before reports whether model comes after the watermark, that is whether it is yet to be processed.
+func (w Watermark) Before(model *Model) bool {
+	if !model.Modified.Equal(w.Modified) {
+		return model.Modified.After(w.Modified)
+	}
+	return model.ID > w.ID
+}
+
+// Changes is a batch of models changed since a watermark, in Modified and then ID order.
+type Changes struct {
+	Models []*Model
+	// Cursor is the watermark after the models of the batch, or the one the batch started at if it
+	// is empty. Jobs store it to resume from it on their next run.
+	Cursor string
+	// More reports whether further changes were left for the next batch.
+	More bool
+}
+
+// ChangeLister is implemented by datastores that can list the models they store by Modified time.
+type ChangeLister interface {
+	// ChangedSince returns the models of itemType modified at or after since, or after cursor if it
+	// is not empty, in Modified and then ID order. A batch holds up to DefaultPageSize models; it may
+	// hold more models modified at the same time as its last one. Expired models are left out.
+	//
+	// Models are only seen if their Modified time is after the watermark when they are saved, so
+	// concurrent savers with skewed clocks may be missed by a job resuming from the watermark.
+	ChangedSince(ctx context.Context, itemType Type, since time.Time, cursor string) (*Changes, error)
+}
+
+// ChangedSince lists a batch of the models of itemType stored in datastore that changed since a
+// watermark. It fails with ErrUnsupported if datastore is not a ChangeLister.
+func ChangedSince(ctx context.Context, datastore Datastore, itemType Type, since time.Time, cursor string) (*Changes, error) {
+	lister, ok := datastore.(ChangeLister)
+	if !ok {
+		e := ErrUnsupported.Wrap(fmt.Errorf("%T cannot list changes", datastore))
+		e.Type = itemType
+		return nil, e
+	}
+	return lister.ChangedSince(ctx, itemType, since, cursor)
+}
+
+// StartWatermark returns the watermark ChangedSince starts at: the one of cursor, or the one just
+// before the models modified at since if cursor is empty. It is meant for ChangeListers.
+func StartWatermark(itemType Type, since time.Time, cursor string) (Watermark, error) {
+	if cursor == "" {
+		return Watermark{Modified: since}, nil
+	}
+
+	watermark, err := ParseCursor(cursor)
+	if err != nil {
+		var e *Error
+		if errors.As(err, &e) {
+			e.Type = itemType
+		}
+		return Watermark{}, err
+	}
+	return watermark, nil
+}
@@ -0,0 +1,49 @@
+package propagatedstorage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/memstore"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSave_StampsModified(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		datastore = memstore.New()
+		service   = propagatedstorage.NewService(datastore, TestType, 0, nil, propagatedstorage.WithClock(MockClock))
+	)
+
+	// Apply
+	err := service.Save(ctx, propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 1, ""))
+	changes, changesErr := propagatedstorage.ChangedSince(ctx, datastore, TestType, MockNow, "")
+
+	// Assert
+	assert.Nil(t, err)
+	require.Nil(t, changesErr)
+	require.Len(t, changes.Models, 1)
+	assert.Equal(t, "ThisIsMyID", changes.Models[0].ID)
+	assert.True(t, MockNow.Equal(changes.Models[0].Modified), "saved models must be Modified at the time of saving")
+}
+
+func TestWatermark_Cursor(t *testing.T) {
+	// Setup
+	watermark := propagatedstorage.Watermark{Modified: time.Date(2020, 1, 1, 12, 0, 0, 500, time.FixedZone("CET", 3600)), ID: "ThisIs|MyID"}
+
+	// Apply
+	parsed, err := propagatedstorage.ParseCursor(watermark.Cursor())
+	_, invalidErr := propagatedstorage.ParseCursor("bm90IGEgd2F0ZXJtYXJr")
+
+	// Assert
+	assert.Nil(t, err)
+	assert.True(t, watermark.Modified.Equal(parsed.Modified))
+	assert.Equal(t, watermark.ID, parsed.ID)
+	assert.True(t, errors.Is(invalidErr, propagatedstorage.ErrInvalidPageToken))
+}
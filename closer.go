@@ -0,0 +1,63 @@
+package propagatedstorage
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Closer is implemented by datastores and services that hold resources or run background work, which
+// Close releases and stops. Closing flushes buffered writes first. Close may be called more than once;
+// datastores shared between services are closed by each of them.
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// Errors is a list of errors, such as those of closing several resources.
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Is reports whether any of the errors is target.
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors that matches target.
+func (e Errors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// CloseAll closes every value that is a Closer, in order, and returns their errors as Errors. Values
+// that are not Closers, such as nil, are skipped.
+func CloseAll(ctx context.Context, values ...interface{}) error {
+	var errs Errors
+	for _, value := range values {
+		if closer, ok := value.(Closer); ok {
+			if err := closer.Close(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
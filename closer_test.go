@@ -0,0 +1,121 @@
+package propagatedstorage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/memstore"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// closingDatastore is a memstore datastore counting how often it is closed.
+type closingDatastore struct {
+	*memstore.Datastore
+	closed int
+	err    error
+}
+
+func (ds *closingDatastore) Close(ctx context.Context) error {
+	ds.closed++
+	return ds.err
+}
+
+// closingService is a fake service counting how often it is closed.
+type closingService struct {
+	*propagatedstoragetest.FakeService
+	closed int
+	err    error
+}
+
+func (s *closingService) Close(ctx context.Context) error {
+	s.closed++
+	return s.err
+}
+
+func TestService_Close(t *testing.T) {
+	// Setup
+	var (
+		datastore = &closingDatastore{Datastore: memstore.New(), err: errors.New("datastore")}
+		fallback  = &closingService{FakeService: propagatedstoragetest.NewFakeService(), err: errors.New("fallback")}
+		service   = propagatedstorage.NewService(datastore, TestType, 0, fallback)
+	)
+
+	// Apply
+	err := propagatedstorage.CloseAll(context.TODO(), service)
+
+	// Assert
+	assert.Equal(t, 1, datastore.closed)
+	assert.Equal(t, 1, fallback.closed)
+	assert.True(t, errors.Is(err, datastore.err))
+	assert.True(t, errors.Is(err, fallback.err))
+	assert.EqualError(t, err, "datastore; fallback")
+}
+
+func TestService_CloseDrainsWriteBacks(t *testing.T) {
+	// Setup
+	var (
+		datastore = &blockingDatastore{Datastore: memstore.New(), release: make(chan struct{})}
+		fallback  = propagatedstoragetest.NewFakeService()
+		service   = propagatedstorage.NewService(datastore, TestType, 0, fallback, propagatedstorage.WithWriteBackPool(propagatedstorage.NewWriteBackPool(1, 10, nil)))
+	)
+	fallback.SetItem(propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 1, "from owner"))
+	assert.Nil(t, service.Get(context.TODO(), propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 0, "")))
+
+	// Apply
+	close(datastore.release)
+	err := service.(propagatedstorage.Closer).Close(context.TODO())
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, 1, datastore.Len())
+}
+
+func TestRouter_Close(t *testing.T) {
+	// Setup
+	var (
+		shared = &closingDatastore{Datastore: memstore.New()}
+		own    = &closingDatastore{Datastore: memstore.New()}
+		router = propagatedstorage.NewRouter(shared)
+	)
+	assert.Nil(t, router.Register("TypeA", propagatedstorage.Route{}))
+	assert.Nil(t, router.Register("TypeB", propagatedstorage.Route{Datastore: own}))
+
+	// Apply
+	err := router.Close(context.TODO())
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, 2, shared.closed, "the default datastore is closed by its route and the router")
+	assert.Equal(t, 1, own.closed)
+}
+
+func TestRouter_ClosesReplacedServices(t *testing.T) {
+	// Setup
+	var (
+		shared   = &closingDatastore{Datastore: memstore.New()}
+		own      = &closingDatastore{Datastore: memstore.New()}
+		replaced = &closingService{FakeService: propagatedstoragetest.NewFakeService()}
+		removed  = &closingService{FakeService: propagatedstoragetest.NewFakeService(), err: errors.New("fallback")}
+		router   = propagatedstorage.NewRouter(shared)
+		ctx      = context.TODO()
+	)
+	assert.Nil(t, router.Register("TypeA", propagatedstorage.Route{FallbackService: replaced}))
+	assert.Nil(t, router.Register("TypeB", propagatedstorage.Route{Datastore: own, FallbackService: removed}))
+
+	// Apply
+	registerErr := router.Register("TypeA", propagatedstorage.Route{})
+	deregisterErr := router.Deregister(ctx, "TypeB")
+
+	// Assert
+	assert.Nil(t, registerErr)
+	assert.Equal(t, 1, replaced.closed)
+	assert.Equal(t, 0, shared.closed, "the default datastore stays open for the other Types")
+
+	assert.True(t, errors.Is(deregisterErr, removed.err))
+	assert.Equal(t, 1, removed.closed)
+	assert.Equal(t, 1, own.closed)
+	assert.Equal(t, []propagatedstorage.Type{"TypeA"}, router.Types())
+}
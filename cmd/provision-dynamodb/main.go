@@ -0,0 +1,91 @@
+// Command provision-dynamodb creates the DynamoDB table of a propagated storage datastore, or adds
+// the indexes and TTL an existing table lacks, and reports how the table differs from what the
+// datastore expects. It exits with status 1 if the table drifted.
+//
+//	provision-dynamodb -table my-table -ttl-attribute Expires -modified-index
+//	provision-dynamodb -table my-table -endpoint http://localhost:8000 -check
+//
+// Credentials come from the environment, as for any AWS SDK.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/Tanax/propagatedstorage/dynamodb"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	ddb "github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func main() {
+	var (
+		spec     dynamodb.TableSpec
+		region   = flag.String("region", "", "region of the table; defaults to the one of the environment")
+		endpoint = flag.String("endpoint", "", "endpoint of DynamoDB, such as the one of DynamoDB Local")
+		check    = flag.Bool("check", false, "only report drift, without changing the table")
+	)
+	flag.StringVar(&spec.TableName, "table", dynamodb.DefaultTableName, "name of the table")
+	flag.StringVar(&spec.PartitionKey, "partition-key", dynamodb.DefaultPartitionKey, "partition key attribute, holding the Type of models")
+	flag.StringVar(&spec.SortKey, "sort-key", dynamodb.DefaultSortKey, "sort key attribute, holding the ID of models")
+	flag.StringVar(&spec.BillingMode, "billing-mode", ddb.BillingModePayPerRequest, "PAY_PER_REQUEST or PROVISIONED")
+	flag.Int64Var(&spec.ReadCapacity, "read-capacity", 0, "read capacity units of the table and indexes in PROVISIONED mode")
+	flag.Int64Var(&spec.WriteCapacity, "write-capacity", 0, "write capacity units of the table and indexes in PROVISIONED mode")
+	flag.StringVar(&spec.TTLAttribute, "ttl-attribute", "", "attribute DynamoDB expires items by, "+dynamodb.TTLAttribute+" for expiring models; no TTL if empty")
+	flag.BoolVar(&spec.ModifiedIndex, "modified-index", false, "add the index of models by Modified")
+	flag.BoolVar(&spec.VersionIndex, "version-index", false, "add the index of models by Version")
+	flag.Parse()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		<-interrupts
+		cancel()
+	}()
+
+	config := aws.NewConfig()
+	if *region != "" {
+		config = config.WithRegion(*region)
+	}
+	if *endpoint != "" {
+		config = config.WithEndpoint(*endpoint)
+	}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		fail(err)
+	}
+	client := ddb.New(sess)
+
+	var drift []dynamodb.Drift
+	if *check {
+		if drift, err = dynamodb.Verify(ctx, client, spec); err != nil {
+			fail(err)
+		}
+	} else {
+		report, err := dynamodb.Provision(ctx, client, spec)
+		if err != nil {
+			fail(err)
+		}
+		for _, applied := range report.Applied {
+			fmt.Println(applied)
+		}
+		drift = report.Drift
+	}
+
+	for _, d := range drift {
+		fmt.Println("drift:", d)
+	}
+	if len(drift) > 0 {
+		os.Exit(1)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "provision-dynamodb:", err)
+	os.Exit(2)
+}
@@ -0,0 +1,73 @@
+package propagatedstorage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Codec serializes propagated items for datastores that store them as bytes. A nil item is encoded as
+// no bytes at all and decoded back to a nil item.
+type Codec interface {
+	Marshal(item Item) ([]byte, error)
+	Unmarshal(itemType Type, data []byte) (Item, error)
+}
+
+// JSONCodec is a Codec that serializes items as JSON. Items are decoded into a new item created by the
+// factory registered for their Type. It is safe for concurrent use.
+type JSONCodec struct {
+	mu        sync.RWMutex
+	factories map[Type]func() Item
+}
+
+// DefaultCodec is the codec of datastores opened by URL that store items as bytes, such as the
+// file:// one. The Types stored through them must be registered on it.
+var DefaultCodec = NewJSONCodec()
+
+// NewJSONCodec creates a new JSON codec without any registered Types.
+func NewJSONCodec() *JSONCodec {
+	return &JSONCodec{
+		factories: make(map[Type]func() Item),
+	}
+}
+
+// Register sets the factory creating the empty item that items of itemType are decoded into.
+func (c *JSONCodec) Register(itemType Type, factory func() Item) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.factories[itemType] = factory
+}
+
+// Marshal encodes item as JSON.
+func (c *JSONCodec) Marshal(item Item) ([]byte, error) {
+	if item == nil {
+		return nil, nil
+	}
+	return json.Marshal(item)
+}
+
+// Unmarshal decodes data into a new item of itemType.
+func (c *JSONCodec) Unmarshal(itemType Type, data []byte) (Item, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	c.mu.RLock()
+	factory, ok := c.factories[itemType]
+	c.mu.RUnlock()
+
+	if !ok {
+		e := ErrUnknownType.Wrap(errors.New("no item registered with the codec"))
+		e.Type = itemType
+		return nil, e
+	}
+
+	item := factory()
+	if err := json.Unmarshal(data, item); err != nil {
+		return nil, fmt.Errorf("could not decode item of type %s: %w", itemType, err)
+	}
+
+	return item, nil
+}
@@ -2,6 +2,7 @@ package propagatedstorage
 
 import (
 	"context"
+	"fmt"
 )
 
 // Datastore represents how our data store should look
@@ -13,3 +14,41 @@ type Datastore interface {
 	// an error if it fails.
 	Save(ctx context.Context, model *Model) error
 }
+
+// Deleter is implemented by datastores that can delete models.
+type Deleter interface {
+	// Delete removes the stored model of the same Type and ID as model. Deleting a model that is not
+	// stored is not an error.
+	Delete(ctx context.Context, model *Model) error
+}
+
+// IDScanner is implemented by datastores that can list the IDs of the models they store.
+type IDScanner interface {
+	// ScanIDs calls fn with the ID of every stored model of itemType, in no particular order. It stops
+	// at the first error returned by fn or when ctx is done.
+	ScanIDs(ctx context.Context, itemType Type, fn func(id string) error) error
+}
+
+// Delete deletes model from datastore. It fails with ErrUnsupported if datastore is not a Deleter.
+func Delete(ctx context.Context, datastore Datastore, model *Model) error {
+	deleter, ok := datastore.(Deleter)
+	if !ok {
+		e := ErrUnsupported.Wrap(fmt.Errorf("%T cannot delete", datastore))
+		e.Type = model.Type
+		e.ID = model.ID
+		return e
+	}
+	return deleter.Delete(ctx, model)
+}
+
+// ScanIDs calls fn with the ID of every model of itemType stored in datastore. It fails with
+// ErrUnsupported if datastore is not an IDScanner.
+func ScanIDs(ctx context.Context, datastore Datastore, itemType Type, fn func(id string) error) error {
+	scanner, ok := datastore.(IDScanner)
+	if !ok {
+		e := ErrUnsupported.Wrap(fmt.Errorf("%T cannot scan IDs", datastore))
+		e.Type = itemType
+		return e
+	}
+	return scanner.ScanIDs(ctx, itemType, fn)
+}
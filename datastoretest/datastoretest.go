@@ -0,0 +1,362 @@
+// Package datastoretest provides a conformance test suite for propagated storage datastores. Every
+// Datastore implementation should pass it:
+//
+//	func TestConformance(t *testing.T) {
+//		datastoretest.RunConformanceTests(t, func(t *testing.T) propagatedstorage.Datastore {
+//			return memstore.New()
+//		})
+//	}
+//
+// Datastores may reject saving a model older than the stored one with propagatedstorage.ErrVersionOutdated.
+// Datastores that serialize items must be able to restore a *propagatedstoragetest.Item for the Types
+// Type and OtherType.
+package datastoretest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// Type is the Type of the items saved by the suite.
+	Type propagatedstorage.Type = "datastoretest"
+	// OtherType is a second Type, used to check that models are keyed by Type as well as ID.
+	OtherType propagatedstorage.Type = "datastoretest.other"
+)
+
+// NewDatastore creates a new, empty datastore for a single test.
+type NewDatastore func(t *testing.T) propagatedstorage.Datastore
+
+// RunConformanceTests runs the conformance suite against the datastores created by newDatastore.
+func RunConformanceTests(t *testing.T, newDatastore NewDatastore) {
+	t.Run("RoundTrip", func(t *testing.T) { testRoundTrip(t, newDatastore(t)) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, newDatastore(t)) })
+	t.Run("KeyedByTypeAndID", func(t *testing.T) { testKeyedByTypeAndID(t, newDatastore(t)) })
+	t.Run("Overwrite", func(t *testing.T) { testOverwrite(t, newDatastore(t)) })
+	t.Run("ConcurrentSaves", func(t *testing.T) { testConcurrentSaves(t, newDatastore(t)) })
+	t.Run("CanceledContext", func(t *testing.T) { testCanceledContext(t, newDatastore(t)) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newDatastore(t)) })
+	t.Run("ScanIDs", func(t *testing.T) { testScanIDs(t, newDatastore(t)) })
+	t.Run("List", func(t *testing.T) { testList(t, newDatastore(t)) })
+	t.Run("ChangedSince", func(t *testing.T) { testChangedSince(t, newDatastore(t)) })
+}
+
+// newModel creates a model holding an item. Timestamps are truncated to milliseconds and kept in UTC,
+// which every backend is expected to preserve.
+func newModel(itemType propagatedstorage.Type, id string, version int, payload string) *propagatedstorage.Model {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	model := propagatedstorage.NewModel(id, itemType, version)
+	model.Item = propagatedstoragetest.NewItem(itemType, id, version, payload)
+	model.Created = now.Add(-time.Hour)
+	model.Modified = now
+
+	return model
+}
+
+func get(ctx context.Context, t *testing.T, ds propagatedstorage.Datastore, itemType propagatedstorage.Type, id string) (*propagatedstorage.Model, error) {
+	t.Helper()
+
+	model := propagatedstorage.NewModel(id, itemType, 0)
+	err := ds.Get(ctx, model)
+
+	return model, err
+}
+
+func assertModel(t *testing.T, want, got *propagatedstorage.Model) {
+	t.Helper()
+
+	assert.Equal(t, want.ID, got.ID)
+	assert.Equal(t, want.Type, got.Type)
+	assert.Equal(t, want.Version, got.Version)
+	assert.Equal(t, want.Item, got.Item)
+	assert.True(t, want.Created.Equal(got.Created), "created: want %v, got %v", want.Created, got.Created)
+	assert.True(t, want.Modified.Equal(got.Modified), "modified: want %v, got %v", want.Modified, got.Modified)
+}
+
+func testRoundTrip(t *testing.T, ds propagatedstorage.Datastore) {
+	ctx := context.Background()
+
+	saved := newModel(Type, "round-trip", 3, "Heyhey")
+	require.Nil(t, ds.Save(ctx, saved))
+
+	got, err := get(ctx, t, ds, Type, "round-trip")
+	require.Nil(t, err)
+	assertModel(t, saved, got)
+}
+
+func testNotFound(t *testing.T, ds propagatedstorage.Datastore) {
+	ctx := context.Background()
+
+	_, err := get(ctx, t, ds, Type, "not-found")
+	assert.True(t, errors.Is(err, propagatedstorage.ErrNotFound), "want ErrNotFound, got %v", err)
+}
+
+func testKeyedByTypeAndID(t *testing.T, ds propagatedstorage.Datastore) {
+	ctx := context.Background()
+
+	first := newModel(Type, "keyed", 1, "first")
+	second := newModel(OtherType, "keyed", 2, "second")
+	require.Nil(t, ds.Save(ctx, first))
+	require.Nil(t, ds.Save(ctx, second))
+
+	got, err := get(ctx, t, ds, Type, "keyed")
+	require.Nil(t, err)
+	assertModel(t, first, got)
+
+	got, err = get(ctx, t, ds, OtherType, "keyed")
+	require.Nil(t, err)
+	assertModel(t, second, got)
+}
+
+func testOverwrite(t *testing.T, ds propagatedstorage.Datastore) {
+	ctx := context.Background()
+
+	require.Nil(t, ds.Save(ctx, newModel(Type, "overwrite", 1, "old")))
+	latest := newModel(Type, "overwrite", 2, "new")
+	require.Nil(t, ds.Save(ctx, latest))
+
+	got, err := get(ctx, t, ds, Type, "overwrite")
+	require.Nil(t, err)
+	assertModel(t, latest, got)
+}
+
+func testConcurrentSaves(t *testing.T, ds propagatedstorage.Datastore) {
+	const (
+		writers = 10
+		ids     = 5
+	)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*ids)
+	for w := 1; w <= writers; w++ {
+		wg.Add(1)
+		go func(version int) {
+			defer wg.Done()
+			for i := 0; i < ids; i++ {
+				id := fmt.Sprintf("concurrent-%d", i)
+				errs <- ds.Save(ctx, newModel(Type, id, version, fmt.Sprintf("%s@%d", id, version)))
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	// Datastores that respect version ordering may reject a save that lost the race to a newer version.
+	for err := range errs {
+		if !errors.Is(err, propagatedstorage.ErrVersionOutdated) {
+			require.Nil(t, err)
+		}
+	}
+
+	// Every ID must hold exactly one of the written models, never a mix of several.
+	for i := 0; i < ids; i++ {
+		id := fmt.Sprintf("concurrent-%d", i)
+		got, err := get(ctx, t, ds, Type, id)
+		require.Nil(t, err)
+
+		item, ok := got.Item.(*propagatedstoragetest.Item)
+		require.True(t, ok, "unexpected item %T", got.Item)
+		assert.True(t, got.Version >= 1 && got.Version <= writers, "unexpected version %d", got.Version)
+		assert.Equal(t, got.Version, item.Version)
+		assert.Equal(t, fmt.Sprintf("%s@%d", id, got.Version), item.Payload)
+	}
+}
+
+func testCanceledContext(t *testing.T, ds propagatedstorage.Datastore) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.NotNil(t, ds.Save(ctx, newModel(Type, "canceled", 1, "canceled")), "want an error saving with a canceled context")
+
+	_, err := get(ctx, t, ds, Type, "canceled")
+	assert.NotNil(t, err, "want an error getting with a canceled context")
+}
+
+func testDelete(t *testing.T, ds propagatedstorage.Datastore) {
+	if _, ok := ds.(propagatedstorage.Deleter); !ok {
+		t.Skipf("%T is not a Deleter", ds)
+	}
+	ctx := context.Background()
+
+	require.Nil(t, ds.Save(ctx, newModel(Type, "delete", 1, "deleted")))
+	require.Nil(t, ds.Save(ctx, newModel(OtherType, "delete", 1, "kept")))
+	require.Nil(t, propagatedstorage.Delete(ctx, ds, propagatedstorage.NewModel("delete", Type, 0)))
+
+	_, err := get(ctx, t, ds, Type, "delete")
+	assert.True(t, errors.Is(err, propagatedstorage.ErrNotFound), "want ErrNotFound after delete, got %v", err)
+
+	_, err = get(ctx, t, ds, OtherType, "delete")
+	assert.Nil(t, err, "deleting must not affect other Types")
+
+	assert.Nil(t, propagatedstorage.Delete(ctx, ds, propagatedstorage.NewModel("never-saved", Type, 0)), "deleting a missing model is not an error")
+}
+
+func testScanIDs(t *testing.T, ds propagatedstorage.Datastore) {
+	if _, ok := ds.(propagatedstorage.IDScanner); !ok {
+		t.Skipf("%T is not an IDScanner", ds)
+	}
+	ctx := context.Background()
+
+	want := []string{"scan-1", "scan-2", "scan-3"}
+	for _, id := range want {
+		require.Nil(t, ds.Save(ctx, newModel(Type, id, 1, id)))
+	}
+	require.Nil(t, ds.Save(ctx, newModel(OtherType, "scan-other", 1, "other")))
+
+	var got []string
+	err := propagatedstorage.ScanIDs(ctx, ds, Type, func(id string) error {
+		got = append(got, id)
+		return nil
+	})
+	if errors.Is(err, propagatedstorage.ErrUnsupported) {
+		t.Skipf("%T cannot scan: %v", ds, err)
+	}
+	require.Nil(t, err)
+	assert.ElementsMatch(t, want, got, "ScanIDs must list exactly the IDs of the scanned Type")
+
+	stop := errors.New("stop")
+	calls := 0
+	err = propagatedstorage.ScanIDs(ctx, ds, Type, func(id string) error {
+		calls++
+		return stop
+	})
+	assert.True(t, errors.Is(err, stop), "ScanIDs must return the error of fn, got %v", err)
+	assert.Equal(t, 1, calls, "ScanIDs must stop at the first error of fn")
+}
+
+func testList(t *testing.T, ds propagatedstorage.Datastore) {
+	if _, ok := ds.(propagatedstorage.Lister); !ok {
+		t.Skipf("%T is not a Lister", ds)
+	}
+	ctx := context.Background()
+
+	start := time.Now().UTC().Truncate(time.Millisecond)
+	for i := 1; i <= 5; i++ {
+		model := newModel(Type, fmt.Sprintf("list-%d", i), i, "")
+		model.Modified = start.Add(time.Duration(i) * time.Second)
+		require.Nil(t, ds.Save(ctx, model))
+	}
+	require.Nil(t, ds.Save(ctx, newModel(OtherType, "list-other", 1, "other")))
+	for _, id := range []string{"list-2-expired", "list-3-expired", "list-6-expired"} {
+		model := newModel(Type, id, 3, "")
+		model.Modified = start.Add(3 * time.Second)
+		model.Expires = start.Add(-time.Minute)
+		require.Nil(t, ds.Save(ctx, model))
+	}
+
+	list := func(filter propagatedstorage.ListFilter) ([]string, error) {
+		var (
+			ids   []string
+			token string
+		)
+		for pages := 0; pages < 10; pages++ {
+			page, err := propagatedstorage.List(ctx, ds, Type, filter, token)
+			if err != nil {
+				return nil, err
+			}
+			if len(page.Models) > filter.Limit() {
+				return nil, fmt.Errorf("page of %d models exceeds the page size", len(page.Models))
+			}
+			if page.NextPageToken != "" && len(page.Models) < filter.Limit() {
+				return nil, fmt.Errorf("page of %d models is followed by another one", len(page.Models))
+			}
+			for _, model := range page.Models {
+				ids = append(ids, model.ID)
+			}
+			if token = page.NextPageToken; token == "" {
+				return ids, nil
+			}
+		}
+		return nil, errors.New("too many pages")
+	}
+
+	ids, err := list(propagatedstorage.ListFilter{PageSize: 2})
+	if errors.Is(err, propagatedstorage.ErrUnsupported) {
+		t.Skipf("%T cannot list: %v", ds, err)
+	}
+	require.Nil(t, err)
+	assert.Equal(t, []string{"list-1", "list-2", "list-3", "list-4", "list-5"}, ids, "List must page through the models of the listed Type in ID order, filling pages past expired models")
+
+	ids, err = list(propagatedstorage.ListFilter{MinVersion: 2, MaxVersion: 4})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"list-2", "list-3", "list-4"}, ids, "List must filter by Version")
+
+	ids, err = list(propagatedstorage.ListFilter{ModifiedSince: start.Add(2 * time.Second), ModifiedBefore: start.Add(4 * time.Second), PageSize: 1})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"list-2", "list-3"}, ids, "List must filter by Modified")
+
+	_, err = propagatedstorage.List(ctx, ds, Type, propagatedstorage.ListFilter{}, "!")
+	assert.True(t, errors.Is(err, propagatedstorage.ErrInvalidPageToken), "want ErrInvalidPageToken, got %v", err)
+}
+
+func testChangedSince(t *testing.T, ds propagatedstorage.Datastore) {
+	if _, ok := ds.(propagatedstorage.ChangeLister); !ok {
+		t.Skipf("%T is not a ChangeLister", ds)
+	}
+	ctx := context.Background()
+
+	start := time.Now().UTC().Truncate(time.Millisecond)
+	save := func(itemType propagatedstorage.Type, id string, modified time.Time) {
+		model := newModel(itemType, id, 1, "")
+		model.Modified = modified
+		require.Nil(t, ds.Save(ctx, model))
+	}
+	save(Type, "changed-c", start.Add(time.Second))
+	save(Type, "changed-b", start.Add(2*time.Second))
+	save(Type, "changed-a", start.Add(2*time.Second))
+	save(Type, "changed-d", start.Add(-time.Second))
+	save(OtherType, "changed-other", start.Add(time.Second))
+
+	ids := func(changes *propagatedstorage.Changes) []string {
+		var ids []string
+		for _, model := range changes.Models {
+			ids = append(ids, model.ID)
+		}
+		return ids
+	}
+
+	changes, err := propagatedstorage.ChangedSince(ctx, ds, Type, start, "")
+	if errors.Is(err, propagatedstorage.ErrUnsupported) {
+		t.Skipf("%T cannot list changes: %v", ds, err)
+	}
+	require.Nil(t, err)
+	assert.Equal(t, []string{"changed-c", "changed-a", "changed-b"}, ids(changes), "ChangedSince must list the models modified since in Modified and then ID order")
+	assert.False(t, changes.More)
+
+	none, err := propagatedstorage.ChangedSince(ctx, ds, Type, start, changes.Cursor)
+	require.Nil(t, err)
+	assert.Empty(t, none.Models, "ChangedSince must resume after the models of the cursor")
+	assert.Equal(t, changes.Cursor, none.Cursor, "an empty batch must keep the cursor")
+
+	save(Type, "changed-c", start.Add(3*time.Second))
+	again, err := propagatedstorage.ChangedSince(ctx, ds, Type, start, changes.Cursor)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"changed-c"}, ids(again), "ChangedSince must list models saved again after the cursor")
+
+	_, err = propagatedstorage.ChangedSince(ctx, ds, Type, start, "!")
+	assert.True(t, errors.Is(err, propagatedstorage.ErrInvalidPageToken), "want ErrInvalidPageToken, got %v", err)
+
+	later := start.Add(time.Minute)
+	for i := 0; i <= propagatedstorage.DefaultPageSize; i++ {
+		save(OtherType, fmt.Sprintf("changed-%03d", i), later.Add(time.Duration(i)*time.Millisecond))
+	}
+	first, err := propagatedstorage.ChangedSince(ctx, ds, OtherType, later, "")
+	require.Nil(t, err)
+	assert.Len(t, first.Models, propagatedstorage.DefaultPageSize)
+	assert.True(t, first.More, "a full batch must report more changes")
+	last, err := propagatedstorage.ChangedSince(ctx, ds, OtherType, later, first.Cursor)
+	require.Nil(t, err)
+	assert.Equal(t, []string{fmt.Sprintf("changed-%03d", propagatedstorage.DefaultPageSize)}, ids(last))
+	assert.False(t, last.More)
+}
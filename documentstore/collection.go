@@ -11,3 +11,21 @@ type Collection interface {
 	Get(ctx context.Context, document interface{}, fps ...docstore.FieldPath) error
 	Put(ctx context.Context, document interface{}) error
 }
+
+// Deleter is implemented by collections that can delete documents, such as *docstore.Collection. The
+// documentstore can only delete models from collections that are Deleters.
+type Deleter interface {
+	Delete(ctx context.Context, document interface{}) error
+}
+
+// Querier is implemented by collections that can be queried, such as *docstore.Collection. The
+// documentstore can only scan collections that are Queriers.
+type Querier interface {
+	Query() *docstore.Query
+}
+
+// Actioner is implemented by collections that can run several actions in a single call, such as
+// *docstore.Collection. The documentstore saves batches through such collections as action lists.
+type Actioner interface {
+	Actions() *docstore.ActionList
+}
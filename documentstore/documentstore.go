@@ -2,36 +2,112 @@ package documentstore
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/Tanax/propagatedstorage"
+	"gocloud.dev/docstore"
+	"gocloud.dev/gcerrors"
+)
+
+const (
+	// DefaultTypeField is the document field holding the Type of models unless WithKeyFields says
+	// otherwise.
+	DefaultTypeField = "Type"
+	// DefaultIDField is the document field holding the ID of models unless WithKeyFields says
+	// otherwise.
+	DefaultIDField = "ID"
 )
 
 type documentstore struct {
-	coll Collection
+	coll      Collection
+	typeField string
+	idField   string
+	maps      bool
+	codec     propagatedstorage.Codec
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Option configures optional behaviour of a document store.
+type Option func(ds *documentstore)
+
+// WithKeyFields sets the names of the document fields holding the Type and the ID of models, which
+// make up the key of the collection. With names other than the fields of Entity, documents are
+// stored as maps instead of Entities, with their item serialized by the codec set by WithCodec.
+func WithKeyFields(typeField, idField string) Option {
+	return func(ds *documentstore) {
+		ds.typeField = typeField
+		ds.idField = idField
+	}
+}
+
+// WithMapDocuments stores documents as maps even with the key fields of Entity. Unlike Entities, map
+// documents hold Modified formatted with ModifiedLayout, which collections that compare it as a
+// string, such as DynamoDB, order in time, as List and ChangedSince need.
+func WithMapDocuments() Option {
+	return func(ds *documentstore) {
+		ds.maps = true
+	}
+}
+
+// WithCodec sets the codec serializing the items of map documents, which collections cannot decode
+// items into without knowing their type. The Types stored must be registered on it. Defaults to
+// propagatedstorage.DefaultCodec.
+func WithCodec(codec propagatedstorage.Codec) Option {
+	return func(ds *documentstore) {
+		ds.codec = codec
+	}
 }
 
 // New returns a new propagated storage datastore of type document store
-func New(coll Collection) propagatedstorage.Datastore {
-	return &documentstore{
-		coll: coll,
+func New(coll Collection, opts ...Option) propagatedstorage.Datastore {
+	ds := &documentstore{
+		coll:      coll,
+		typeField: DefaultTypeField,
+		idField:   DefaultIDField,
+		codec:     propagatedstorage.DefaultCodec,
+	}
+
+	for _, opt := range opts {
+		opt(ds)
 	}
+
+	return ds
 }
 
 func (ds *documentstore) Get(ctx context.Context, model *propagatedstorage.Model) error {
-	entity, err := NewFromModel(model)
+	entity, err := ds.document(model)
 	if err != nil {
 		return err
 	}
 
 	if err := ds.coll.Get(ctx, entity); err != nil {
+		if gcerrors.Code(err) == gcerrors.NotFound {
+			e := propagatedstorage.ErrNotFound.Wrap(err)
+			e.Type = model.Type
+			e.ID = model.ID
+			return e
+		}
 		return err
 	}
 
-	return entity.populateModel(model)
+	if err := ds.populateModel(entity, model); err != nil {
+		return err
+	}
+	if document, ok := entity.(map[string]interface{}); ok {
+		return ds.decodeItem(document, model)
+	}
+	return nil
 }
 
 func (ds *documentstore) Save(ctx context.Context, model *propagatedstorage.Model) error {
-	entity, err := NewFromModel(model)
+	entity, err := ds.document(model)
 	if err != nil {
 		return err
 	}
@@ -40,5 +116,358 @@ func (ds *documentstore) Save(ctx context.Context, model *propagatedstorage.Mode
 		return err
 	}
 
-	return entity.populateModel(model)
+	return ds.populateModel(entity, model)
+}
+
+// SaveBatch saves models in a single action list if the collection is an Actioner, and one by one
+// otherwise. Models that could not be saved are reported in a *propagatedstorage.BatchError.
+func (ds *documentstore) SaveBatch(ctx context.Context, models []*propagatedstorage.Model) error {
+	entities := make([]interface{}, len(models))
+	for i, model := range models {
+		entity, err := ds.document(model)
+		if err != nil {
+			return err
+		}
+		entities[i] = entity
+	}
+
+	errs := make(map[int]error)
+	if actioner, ok := ds.coll.(Actioner); ok {
+		actions := actioner.Actions()
+		for _, entity := range entities {
+			actions.Put(entity)
+		}
+		if err := actions.Do(ctx); err != nil {
+			actionErrs, ok := err.(docstore.ActionListError)
+			if !ok {
+				return err
+			}
+			for _, actionErr := range actionErrs {
+				errs[actionErr.Index] = actionErr.Err
+			}
+		}
+	} else {
+		for i, entity := range entities {
+			if err := ds.coll.Put(ctx, entity); err != nil {
+				errs[i] = err
+			}
+		}
+	}
+
+	for i, entity := range entities {
+		if _, failed := errs[i]; !failed {
+			ds.populateModel(entity, models[i])
+		}
+	}
+
+	if len(errs) > 0 {
+		return &propagatedstorage.BatchError{Errors: errs}
+	}
+	return nil
+}
+
+// Delete removes the stored model of the same Type and ID as model. It fails with
+// propagatedstorage.ErrUnsupported unless the collection is a Deleter.
+func (ds *documentstore) Delete(ctx context.Context, model *propagatedstorage.Model) error {
+	deleter, ok := ds.coll.(Deleter)
+	if !ok {
+		e := propagatedstorage.ErrUnsupported.Wrap(fmt.Errorf("%T cannot delete", ds.coll))
+		e.Type = model.Type
+		e.ID = model.ID
+		return e
+	}
+
+	entity, err := ds.document(model)
+	if err != nil {
+		return err
+	}
+
+	return deleter.Delete(ctx, entity)
+}
+
+// ScanIDs calls fn with the ID of every stored model of itemType. It queries the collection for the
+// ID field only, so it fails with propagatedstorage.ErrUnsupported unless the collection is a Querier.
+func (ds *documentstore) ScanIDs(ctx context.Context, itemType propagatedstorage.Type, fn func(id string) error) error {
+	querier, ok := ds.coll.(Querier)
+	if !ok {
+		e := propagatedstorage.ErrUnsupported.Wrap(fmt.Errorf("%T cannot be queried", ds.coll))
+		e.Type = itemType
+		return e
+	}
+
+	iter := querier.Query().Where(docstore.FieldPath(ds.typeField), "=", string(itemType)).Get(ctx, docstore.FieldPath(ds.idField))
+	defer iter.Stop()
+
+	for {
+		document := make(map[string]interface{})
+		err := iter.Next(ctx, document)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		id, _ := document[ds.idField].(string)
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+}
+
+// List returns a page of the models of itemType passing filter, in ID order. It queries the
+// collection for models after the last ID of the previous page, which the page token holds, and fails
+// with propagatedstorage.ErrUnsupported unless the collection is a Querier.
+//
+// Listed models have no Item, as collections cannot decode items without knowing their type. Get
+// them to read their items.
+func (ds *documentstore) List(ctx context.Context, itemType propagatedstorage.Type, filter propagatedstorage.ListFilter, pageToken string) (*propagatedstorage.Page, error) {
+	querier, ok := ds.coll.(Querier)
+	if !ok {
+		e := propagatedstorage.ErrUnsupported.Wrap(fmt.Errorf("%T cannot be queried", ds.coll))
+		e.Type = itemType
+		return nil, e
+	}
+
+	after, err := base64.RawURLEncoding.DecodeString(pageToken)
+	if err != nil {
+		e := propagatedstorage.ErrInvalidPageToken.Wrap(err)
+		e.Type = itemType
+		return nil, e
+	}
+
+	// The query has no limit, as some collections limit before they order; reading stops after the
+	// page instead.
+	limit := filter.Limit()
+	query := querier.Query().Where(docstore.FieldPath(ds.typeField), "=", string(itemType))
+	if pageToken != "" {
+		query = query.Where(docstore.FieldPath(ds.idField), ">", string(after))
+	} else {
+		// Ordering needs a condition on the ID. DynamoDB collections encode empty strings as NULL, so
+		// the first page starts at the lowest non-empty ID instead of after the empty one.
+		query = query.Where(docstore.FieldPath(ds.idField), ">=", "\x00")
+	}
+	query = query.OrderBy(ds.idField, docstore.Ascending)
+	if filter.MinVersion > 0 {
+		query = query.Where("Version", ">=", filter.MinVersion)
+	}
+	if filter.MaxVersion > 0 {
+		query = query.Where("Version", "<=", filter.MaxVersion)
+	}
+	if !filter.ModifiedSince.IsZero() {
+		query = query.Where("Modified", ">=", ds.modified(filter.ModifiedSince))
+	}
+	if !filter.ModifiedBefore.IsZero() {
+		query = query.Where("Modified", "<", ds.modified(filter.ModifiedBefore))
+	}
+
+	iter := query.Get(ctx, ds.modelFields()...)
+	defer iter.Stop()
+
+	var (
+		page = new(propagatedstorage.Page)
+		now  = time.Now()
+	)
+	for {
+		document := make(map[string]interface{})
+		err := iter.Next(ctx, document)
+		if err == io.EOF {
+			return page, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		model, err := ds.queriedModel(document)
+		if err != nil {
+			return nil, err
+		}
+		if model.Expired(now) {
+			// Expired models do not count toward the page, which is filled with the models after them.
+			continue
+		}
+		if len(page.Models) == limit {
+			// There is more after this page, which ends at the model read before.
+			page.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(page.Models[limit-1].ID))
+			return page, nil
+		}
+		page.Models = append(page.Models, model)
+	}
+}
+
+// ChangedSince returns a batch of the models of itemType modified after the watermark of since or
+// cursor, in Modified and then ID order. It queries the collection by Modified, which DynamoDB
+// collections need the index provisioned by dynamodb.TableSpec.ModifiedIndex for. DynamoDB compares
+// Modified as a string, which only orders it in time in map documents, so models saved as Entities or
+// before map documents held ModifiedLayout must be saved again before they are listed reliably. It fails with
+// propagatedstorage.ErrUnsupported unless the collection is a Querier that can run such queries.
+//
+// Like listed models, the models have no Item.
+func (ds *documentstore) ChangedSince(ctx context.Context, itemType propagatedstorage.Type, since time.Time, cursor string) (*propagatedstorage.Changes, error) {
+	querier, ok := ds.coll.(Querier)
+	if !ok {
+		e := propagatedstorage.ErrUnsupported.Wrap(fmt.Errorf("%T cannot be queried", ds.coll))
+		e.Type = itemType
+		return nil, e
+	}
+
+	watermark, err := propagatedstorage.StartWatermark(itemType, since, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	iter := querier.Query().
+		Where(docstore.FieldPath(ds.typeField), "=", string(itemType)).
+		Where("Modified", ">=", ds.modified(watermark.Modified)).
+		OrderBy("Modified", docstore.Ascending).
+		Get(ctx, ds.modelFields()...)
+	defer iter.Stop()
+
+	var (
+		changes = new(propagatedstorage.Changes)
+		now     = time.Now()
+	)
+	for {
+		document := make(map[string]interface{})
+		err := iter.Next(ctx, document)
+		if err == io.EOF {
+			break
+		}
+		if gcerrors.Code(err) == gcerrors.Unimplemented {
+			e := propagatedstorage.ErrUnsupported.Wrap(err)
+			e.Type = itemType
+			return nil, e
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		model, err := ds.queriedModel(document)
+		if err != nil {
+			return nil, err
+		}
+		if !watermark.Before(model) || model.Expired(now) {
+			continue
+		}
+
+		// Models modified at the same time are not ordered by ID, so all of them go in the batch for
+		// the cursor to be after every one of them.
+		if n := len(changes.Models); n >= propagatedstorage.DefaultPageSize && !model.Modified.Equal(changes.Models[n-1].Modified) {
+			changes.More = true
+			break
+		}
+		changes.Models = append(changes.Models, model)
+	}
+
+	sort.Slice(changes.Models, func(i, j int) bool {
+		if !changes.Models[i].Modified.Equal(changes.Models[j].Modified) {
+			return changes.Models[i].Modified.Before(changes.Models[j].Modified)
+		}
+		return changes.Models[i].ID < changes.Models[j].ID
+	})
+	if n := len(changes.Models); n > 0 {
+		watermark = propagatedstorage.Watermark{Modified: changes.Models[n-1].Modified, ID: changes.Models[n-1].ID}
+	}
+	changes.Cursor = watermark.Cursor()
+
+	return changes, nil
+}
+
+// Close closes the collection if it is an io.Closer, such as *docstore.Collection. The collection is
+// closed once, however often Close is called.
+func (ds *documentstore) Close(ctx context.Context) error {
+	ds.closeOnce.Do(func() {
+		if closer, ok := ds.coll.(io.Closer); ok {
+			ds.closeErr = closer.Close()
+		}
+	})
+	return ds.closeErr
+}
+
+// document returns the document model is stored as: an Entity, or a map if the key fields are not
+// the ones of Entity.
+func (ds *documentstore) document(model *propagatedstorage.Model) (interface{}, error) {
+	entity, err := NewFromModel(model)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ds.mapDocuments() {
+		return entity, nil
+	}
+
+	item, err := ds.codec.Marshal(model.Item)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode item: %w", err)
+	}
+	return entity.toDocument(ds.typeField, ds.idField, item), nil
+}
+
+// mapDocuments reports whether models are stored as map documents rather than Entities.
+func (ds *documentstore) mapDocuments() bool {
+	return ds.maps || ds.typeField != DefaultTypeField || ds.idField != DefaultIDField
+}
+
+// modified returns t as it is stored in the Modified field of documents, to compare it in queries.
+func (ds *documentstore) modified(t time.Time) interface{} {
+	if ds.mapDocuments() {
+		return formatModified(t)
+	}
+	return t.UTC()
+}
+
+// decodeItem sets the Item of model to the one serialized in a map document.
+func (ds *documentstore) decodeItem(document map[string]interface{}, model *propagatedstorage.Model) error {
+	var data []byte
+	switch item := document["Item"].(type) {
+	case nil:
+	case []byte:
+		data = item
+	default:
+		return fmt.Errorf("field Item: unexpected item %T", item)
+	}
+
+	item, err := ds.codec.Unmarshal(model.Type, data)
+	if err != nil {
+		return err
+	}
+	model.Item = item
+	return nil
+}
+
+// modelFields are the fields queries read to populate models. Items are left out, as collections
+// cannot decode them without knowing their type.
+func (ds *documentstore) modelFields() []docstore.FieldPath {
+	return []docstore.FieldPath{docstore.FieldPath(ds.typeField), docstore.FieldPath(ds.idField), "Version", "Created", "Modified", "Expires"}
+}
+
+// queriedModel returns the model of a document read by a query of the model fields.
+func (ds *documentstore) queriedModel(document map[string]interface{}) (*propagatedstorage.Model, error) {
+	entity, err := newFromDocument(document, ds.typeField, ds.idField)
+	if err != nil {
+		return nil, err
+	}
+
+	model := propagatedstorage.NewModel(entity.ID, entity.Type, 0)
+	if err := entity.populateModel(model); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// populateModel populates model from a document returned by document. The items of map documents
+// are left alone; decodeItem decodes them.
+func (ds *documentstore) populateModel(document interface{}, model *propagatedstorage.Model) error {
+	switch document := document.(type) {
+	case *Entity:
+		return document.populateModel(model)
+	case map[string]interface{}:
+		entity, err := newFromDocument(document, ds.typeField, ds.idField)
+		if err != nil {
+			return err
+		}
+		entity.Item = model.Item
+		return entity.populateModel(model)
+	default:
+		return fmt.Errorf("unexpected document %T", document)
+	}
 }
@@ -3,12 +3,18 @@ package documentstore_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/datastoretest"
 	"github.com/Tanax/propagatedstorage/documentstore"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/docstore"
+	"gocloud.dev/docstore/memdocstore"
 )
 
 func TestGet_Success(t *testing.T) {
@@ -116,3 +122,405 @@ func TestSave_CollectionError(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.EqualError(t, err, "error")
 }
+
+func TestGet_NotFound(t *testing.T) {
+	// Setup
+	ctx := context.TODO()
+
+	// Mock
+	var (
+		model         = &propagatedstorage.Model{ID: "ThisIsMyID", Type: "MyType"}
+		collection, _ = memdocstore.OpenCollection("ID", nil)
+	)
+	defer collection.Close()
+
+	// Apply
+	docstore := documentstore.New(collection)
+	err := docstore.Get(ctx, model)
+
+	// Assert
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, propagatedstorage.ErrNotFound))
+}
+
+func TestConformance(t *testing.T) {
+	datastoretest.RunConformanceTests(t, func(t *testing.T) propagatedstorage.Datastore {
+		return documentstore.New(propagatedstoragetest.NewFakeCollection())
+	})
+}
+
+// TestConformance_Memdocstore runs the suite against a docstore collection, which can run the queries
+// of ScanIDs, List and ChangedSince. Collections cannot decode items into an Entity, so the collection
+// holds map documents with their items serialized.
+func TestConformance_Memdocstore(t *testing.T) {
+	codec := propagatedstorage.NewJSONCodec()
+	for _, itemType := range []propagatedstorage.Type{datastoretest.Type, datastoretest.OtherType} {
+		codec.Register(itemType, func() propagatedstorage.Item { return new(propagatedstoragetest.Item) })
+	}
+
+	datastoretest.RunConformanceTests(t, func(t *testing.T) propagatedstorage.Datastore {
+		collection, err := memdocstore.OpenCollectionWithKeyFunc(func(doc docstore.Document) interface{} {
+			document := doc.(map[string]interface{})
+			return fmt.Sprintf("%v/%v", document["ItemType"], document["ItemID"])
+		}, nil)
+		require.Nil(t, err)
+		return documentstore.New(collection, documentstore.WithKeyFields("ItemType", "ItemID"), documentstore.WithCodec(codec))
+	})
+}
+
+func TestSave_Expires(t *testing.T) {
+	// Setup
+	var (
+		ctx     = context.TODO()
+		ds      = documentstore.New(propagatedstoragetest.NewFakeCollection())
+		expires = time.Now().Add(time.Hour)
+		model   = propagatedstorage.NewModel("ThisIsMyID", "MyType", 1)
+	)
+	model.Expires = expires
+
+	// Apply
+	saveErr := ds.Save(ctx, model)
+	stored := propagatedstorage.NewModel("ThisIsMyID", "MyType", 0)
+	getErr := ds.Get(ctx, stored)
+	entity, _ := documentstore.NewFromModel(model)
+
+	// Assert
+	assert.Nil(t, saveErr)
+	assert.Nil(t, getErr)
+	assert.Equal(t, expires.Unix(), entity.Expires, "the expiry must be stored as a Unix time in seconds")
+	assert.True(t, expires.Truncate(time.Second).Equal(stored.Expires))
+}
+
+func TestScanIDs(t *testing.T) {
+	// Setup
+	ctx := context.TODO()
+	collection, err := memdocstore.OpenCollectionWithKeyFunc(func(doc docstore.Document) interface{} {
+		entity := doc.(*documentstore.Entity)
+		return string(entity.Type) + "/" + entity.ID
+	}, nil)
+	assert.Nil(t, err)
+	defer collection.Close()
+
+	for _, entity := range []*documentstore.Entity{
+		{ID: "first", Type: "MyType", Version: 1},
+		{ID: "second", Type: "MyType", Version: 1},
+		{ID: "other", Type: "OtherType", Version: 1},
+	} {
+		assert.Nil(t, collection.Put(ctx, entity))
+	}
+
+	// Apply
+	var ids []string
+	err = documentstore.New(collection).(propagatedstorage.IDScanner).ScanIDs(ctx, "MyType", func(id string) error {
+		ids = append(ids, id)
+		return nil
+	})
+
+	// Assert
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"first", "second"}, ids)
+}
+
+func TestDelete_Unsupported(t *testing.T) {
+	// Apply
+	err := propagatedstorage.Delete(context.TODO(), documentstore.New(&TestCollection{}), propagatedstorage.NewModel("ThisIsMyID", "MyType", 0))
+
+	// Assert
+	assert.True(t, errors.Is(err, propagatedstorage.ErrUnsupported))
+}
+
+func TestScanIDs_Unsupported(t *testing.T) {
+	// Apply
+	err := propagatedstorage.ScanIDs(context.TODO(), documentstore.New(&TestCollection{}), "MyType", func(string) error { return nil })
+
+	// Assert
+	assert.True(t, errors.Is(err, propagatedstorage.ErrUnsupported))
+}
+
+func TestSaveBatch(t *testing.T) {
+	// Setup
+	ctx := context.TODO()
+	collection, err := memdocstore.OpenCollectionWithKeyFunc(func(doc docstore.Document) interface{} {
+		entity := doc.(*documentstore.Entity)
+		return string(entity.Type) + "/" + entity.ID
+	}, nil)
+	assert.Nil(t, err)
+	defer collection.Close()
+	ds := documentstore.New(collection)
+
+	// Apply
+	err = propagatedstorage.SaveBatch(ctx, ds, []*propagatedstorage.Model{
+		propagatedstorage.NewModel("first", "MyType", 1),
+		propagatedstorage.NewModel("second", "MyType", 2),
+	})
+
+	// Assert
+	assert.Nil(t, err)
+	for id, version := range map[string]int{"first": 1, "second": 2} {
+		model := propagatedstorage.NewModel(id, "MyType", 0)
+		assert.Nil(t, ds.Get(ctx, model))
+		assert.Equal(t, version, model.Version)
+	}
+}
+
+func TestSaveBatch_PartialFailure(t *testing.T) {
+	// Setup
+	var (
+		ctx        = context.TODO()
+		collection = &TestCollection{}
+		models     = []*propagatedstorage.Model{
+			propagatedstorage.NewModel("first", "MyType", 1),
+			propagatedstorage.NewModel("second", "MyType", 1),
+		}
+		first, _  = documentstore.NewFromModel(models[0])
+		second, _ = documentstore.NewFromModel(models[1])
+	)
+
+	// Expect
+	collection.On("Put", ctx, first).Return(nil)
+	collection.On("Put", ctx, second).Return(errors.New("error"))
+
+	// Apply
+	err := propagatedstorage.SaveBatch(ctx, documentstore.New(collection), models)
+
+	// Assert
+	collection.AssertExpectations(t)
+	var batchErr *propagatedstorage.BatchError
+	assert.True(t, errors.As(err, &batchErr))
+	assert.Len(t, batchErr.Errors, 1)
+	assert.EqualError(t, batchErr.Errors[1], "error")
+}
+
+func TestClose(t *testing.T) {
+	// Setup
+	collection, err := memdocstore.OpenCollection("ID", nil)
+	assert.Nil(t, err)
+	ds := documentstore.New(collection)
+
+	// Apply
+	first := propagatedstorage.CloseAll(context.TODO(), ds)
+	second := propagatedstorage.CloseAll(context.TODO(), ds)
+
+	// Assert
+	assert.Nil(t, first)
+	assert.Nil(t, second, "closing again must not fail")
+	assert.NotNil(t, collection.Put(context.TODO(), &documentstore.Entity{ID: "ThisIsMyID"}), "the collection must be closed")
+}
+
+func TestWithKeyFields(t *testing.T) {
+	// Setup
+	ctx := context.TODO()
+	collection, err := memdocstore.OpenCollectionWithKeyFunc(func(doc docstore.Document) interface{} {
+		document := doc.(map[string]interface{})
+		return fmt.Sprint(document["pk"], "/", document["sk"])
+	}, nil)
+	assert.Nil(t, err)
+	defer collection.Close()
+
+	var (
+		codec = propagatedstorage.NewJSONCodec()
+		ds    = documentstore.New(collection, documentstore.WithKeyFields("pk", "sk"), documentstore.WithCodec(codec))
+		now   = time.Now().UTC()
+		model = propagatedstorage.NewModel("ThisIsMyID", "MyType", 3)
+	)
+	codec.Register("MyType", func() propagatedstorage.Item { return new(propagatedstoragetest.Item) })
+	model.Item = propagatedstoragetest.NewItem("MyType", "ThisIsMyID", 3, "Heyhey")
+	model.Created = now.Add(-time.Hour)
+	model.Modified = now
+
+	// Apply
+	saveErr := ds.Save(ctx, model)
+
+	stored := propagatedstorage.NewModel("ThisIsMyID", "MyType", 0)
+	getErr := ds.Get(ctx, stored)
+
+	unregistered := documentstore.New(collection, documentstore.WithKeyFields("pk", "sk"), documentstore.WithCodec(propagatedstorage.NewJSONCodec()))
+	unknownErr := unregistered.Get(ctx, propagatedstorage.NewModel("ThisIsMyID", "MyType", 0))
+
+	document := map[string]interface{}{"pk": "MyType", "sk": "ThisIsMyID"}
+	rawErr := collection.Get(ctx, document)
+
+	var ids []string
+	scanErr := propagatedstorage.ScanIDs(ctx, ds, "MyType", func(id string) error {
+		ids = append(ids, id)
+		return nil
+	})
+
+	// Assert
+	assert.Nil(t, saveErr)
+	assert.Nil(t, getErr)
+	assert.Equal(t, 3, stored.Version)
+	assert.Equal(t, model.Item, stored.Item, "the item must be decoded from the document")
+	assert.True(t, errors.Is(unknownErr, propagatedstorage.ErrUnknownType), "items of unregistered Types must not be read as misses")
+	assert.True(t, model.Created.Equal(stored.Created))
+	assert.True(t, model.Modified.Equal(stored.Modified))
+	assert.Nil(t, rawErr, "the document must be keyed by the custom fields")
+	assert.Nil(t, scanErr)
+	assert.Equal(t, []string{"ThisIsMyID"}, ids)
+}
+
+func TestList(t *testing.T) {
+	// Setup
+	ctx := context.TODO()
+	collection, err := memdocstore.OpenCollectionWithKeyFunc(func(doc docstore.Document) interface{} {
+		entity := doc.(*documentstore.Entity)
+		return string(entity.Type) + "/" + entity.ID
+	}, nil)
+	assert.Nil(t, err)
+	defer collection.Close()
+
+	var (
+		ds    = documentstore.New(collection)
+		start = time.Now().UTC()
+	)
+	for i := 1; i <= 5; i++ {
+		model := propagatedstorage.NewModel(fmt.Sprintf("id-%d", i), "MyType", i)
+		model.Modified = start.Add(time.Duration(i) * time.Second)
+		assert.Nil(t, ds.Save(ctx, model))
+	}
+	expired := propagatedstorage.NewModel("id-6", "MyType", 6)
+	expired.Expires = start.Add(-time.Minute)
+	assert.Nil(t, ds.Save(ctx, expired))
+	assert.Nil(t, ds.Save(ctx, propagatedstorage.NewModel("other", "OtherType", 1)))
+
+	// Apply
+	first, firstErr := propagatedstorage.List(ctx, ds, "MyType", propagatedstorage.ListFilter{PageSize: 3}, "")
+	second, secondErr := propagatedstorage.List(ctx, ds, "MyType", propagatedstorage.ListFilter{PageSize: 3}, first.NextPageToken)
+	filtered, filteredErr := propagatedstorage.List(ctx, ds, "MyType", propagatedstorage.ListFilter{
+		MinVersion:     2,
+		ModifiedBefore: start.Add(4 * time.Second),
+	}, "")
+
+	// Assert
+	ids := func(page *propagatedstorage.Page) []string {
+		var ids []string
+		for _, model := range page.Models {
+			ids = append(ids, model.ID)
+		}
+		return ids
+	}
+
+	assert.Nil(t, firstErr)
+	assert.Equal(t, []string{"id-1", "id-2", "id-3"}, ids(first))
+	assert.Equal(t, 1, first.Models[0].Version)
+	assert.True(t, start.Add(time.Second).Equal(first.Models[0].Modified))
+	assert.NotEmpty(t, first.NextPageToken)
+
+	assert.Nil(t, secondErr)
+	assert.Equal(t, []string{"id-4", "id-5"}, ids(second), "expired models must be left out")
+	assert.Empty(t, second.NextPageToken)
+
+	assert.Nil(t, filteredErr)
+	assert.Equal(t, []string{"id-2", "id-3"}, ids(filtered))
+}
+
+func TestList_SubSecondModified(t *testing.T) {
+	// Setup
+	ctx := context.TODO()
+	collection, err := memdocstore.OpenCollectionWithKeyFunc(func(doc docstore.Document) interface{} {
+		document := doc.(map[string]interface{})
+		return fmt.Sprintf("%v/%v", document["Type"], document["ID"])
+	}, nil)
+	assert.Nil(t, err)
+	defer collection.Close()
+
+	var (
+		ds    = documentstore.New(collection, documentstore.WithMapDocuments())
+		start = time.Date(2020, 1, 1, 12, 0, 5, 100000000, time.FixedZone("CET", 3600))
+	)
+	earlier := propagatedstorage.NewModel("earlier", "MyType", 1)
+	earlier.Modified = start
+	assert.Nil(t, ds.Save(ctx, earlier))
+	later := propagatedstorage.NewModel("later", "MyType", 1)
+	later.Modified = start.Add(10 * time.Microsecond)
+	assert.Nil(t, ds.Save(ctx, later))
+
+	// Apply
+	page, listErr := propagatedstorage.List(ctx, ds, "MyType", propagatedstorage.ListFilter{ModifiedSince: later.Modified}, "")
+	changes, changesErr := propagatedstorage.ChangedSince(ctx, ds, "MyType", start.Add(-time.Microsecond), "")
+	stored := map[string]interface{}{"Type": "MyType", "ID": "earlier"}
+	getErr := collection.Get(ctx, stored)
+
+	// Assert
+	assert.Nil(t, getErr)
+	assert.Equal(t, "2020-01-01T11:00:05.100000000Z", stored["Modified"], "times must be stored with a fixed width")
+
+	assert.Nil(t, listErr)
+	require.Len(t, page.Models, 1)
+	assert.Equal(t, "later", page.Models[0].ID)
+
+	assert.Nil(t, changesErr)
+	require.Len(t, changes.Models, 2)
+	assert.Equal(t, "earlier", changes.Models[0].ID)
+	assert.True(t, start.Equal(changes.Models[0].Modified))
+	assert.Equal(t, "later", changes.Models[1].ID)
+}
+
+func TestList_Unsupported(t *testing.T) {
+	// Apply
+	_, err := propagatedstorage.List(context.TODO(), documentstore.New(&TestCollection{}), "MyType", propagatedstorage.ListFilter{}, "")
+
+	// Assert
+	assert.True(t, errors.Is(err, propagatedstorage.ErrUnsupported))
+}
+
+func TestChangedSince(t *testing.T) {
+	// Setup
+	ctx := context.TODO()
+	collection, err := memdocstore.OpenCollectionWithKeyFunc(func(doc docstore.Document) interface{} {
+		entity := doc.(*documentstore.Entity)
+		return string(entity.Type) + "/" + entity.ID
+	}, nil)
+	assert.Nil(t, err)
+	defer collection.Close()
+
+	var (
+		ds    = documentstore.New(collection)
+		start = time.Now().UTC()
+	)
+	for id, offset := range map[string]time.Duration{"id-1": -time.Second, "id-2": 2 * time.Second, "id-3": time.Second, "id-4": time.Second} {
+		model := propagatedstorage.NewModel(id, "MyType", 1)
+		model.Modified = start.Add(offset)
+		assert.Nil(t, ds.Save(ctx, model))
+	}
+	expired := propagatedstorage.NewModel("id-5", "MyType", 1)
+	expired.Modified = start.Add(time.Second)
+	expired.Expires = start.Add(-time.Minute)
+	assert.Nil(t, ds.Save(ctx, expired))
+	other := propagatedstorage.NewModel("other", "OtherType", 1)
+	other.Modified = start.Add(time.Second)
+	assert.Nil(t, ds.Save(ctx, other))
+
+	// Apply
+	changes, changesErr := propagatedstorage.ChangedSince(ctx, ds, "MyType", start, "")
+	resaved := propagatedstorage.NewModel("id-3", "MyType", 2)
+	resaved.Modified = start.Add(3 * time.Second)
+	assert.Nil(t, ds.Save(ctx, resaved))
+	resumed, resumedErr := propagatedstorage.ChangedSince(ctx, ds, "MyType", start, changes.Cursor)
+
+	// Assert
+	ids := func(changes *propagatedstorage.Changes) []string {
+		var ids []string
+		for _, model := range changes.Models {
+			ids = append(ids, model.ID)
+		}
+		return ids
+	}
+
+	assert.Nil(t, changesErr)
+	assert.Equal(t, []string{"id-3", "id-4", "id-2"}, ids(changes), "expired models must be left out")
+	assert.True(t, start.Add(2*time.Second).Equal(changes.Models[2].Modified))
+	assert.False(t, changes.More)
+
+	assert.Nil(t, resumedErr)
+	assert.Equal(t, []string{"id-3"}, ids(resumed))
+	assert.Equal(t, 2, resumed.Models[0].Version)
+}
+
+func TestChangedSince_Unsupported(t *testing.T) {
+	// Apply
+	_, err := propagatedstorage.ChangedSince(context.TODO(), documentstore.New(&TestCollection{}), "MyType", time.Time{}, "")
+
+	// Assert
+	assert.True(t, errors.Is(err, propagatedstorage.ErrUnsupported))
+}
@@ -1,11 +1,16 @@
 package documentstore
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/Tanax/propagatedstorage"
 )
 
+// ModifiedLayout is the layout of the Modified times of map documents, in UTC. It has a fixed width,
+// so collections that compare the times as strings, such as DynamoDB, order them in time.
+const ModifiedLayout = "2006-01-02T15:04:05.000000000Z"
+
 // Entity defines how our documents store entity looks like.
 type Entity struct {
 	ID      string
@@ -15,6 +20,9 @@ type Entity struct {
 
 	Created  time.Time
 	Modified time.Time
+	// Expires is the Unix time in seconds the model expires at, or zero if it never does, which is
+	// how DynamoDB expects the TTL attribute of a table.
+	Expires int64 `docstore:",omitempty"`
 }
 
 func (e *Entity) populateModel(model *propagatedstorage.Model) error {
@@ -24,6 +32,10 @@ func (e *Entity) populateModel(model *propagatedstorage.Model) error {
 	model.Version = e.Version
 	model.Created = e.Created
 	model.Modified = e.Modified
+	model.Expires = time.Time{}
+	if e.Expires != 0 {
+		model.Expires = time.Unix(e.Expires, 0)
+	}
 
 	return nil
 }
@@ -36,8 +48,101 @@ func NewFromModel(model *propagatedstorage.Model) (*Entity, error) {
 	e.Type = model.Type
 	e.Item = model.Item
 	e.Version = model.Version
-	e.Created = model.Created
-	e.Modified = model.Modified
+	e.Created = model.Created.UTC()
+	e.Modified = model.Modified.UTC()
+	if !model.Expires.IsZero() {
+		e.Expires = model.Expires.Unix()
+	}
+
+	return e, nil
+}
+
+// toDocument returns e as a map document with its Type and ID in typeField and idField, and its item
+// serialized as item. Modified is formatted with ModifiedLayout.
+func (e *Entity) toDocument(typeField, idField string, item []byte) map[string]interface{} {
+	document := map[string]interface{}{
+		typeField:  string(e.Type),
+		idField:    e.ID,
+		"Version":  e.Version,
+		"Created":  e.Created,
+		"Modified": formatModified(e.Modified),
+	}
+	if len(item) > 0 {
+		document["Item"] = item
+	}
+	if e.Expires != 0 {
+		document["Expires"] = e.Expires
+	}
+	return document
+}
+
+// newFromDocument creates a new Entity without an item from a map document with its Type and ID in
+// typeField and idField. Collections decode numbers and times in maps differently, so both are
+// converted.
+func newFromDocument(document map[string]interface{}, typeField, idField string) (*Entity, error) {
+	e := new(Entity)
+
+	itemType, _ := document[typeField].(string)
+	e.Type = propagatedstorage.Type(itemType)
+	e.ID, _ = document[idField].(string)
+
+	var err error
+	if e.Version, err = documentInt(document["Version"]); err != nil {
+		return nil, fmt.Errorf("field Version: %w", err)
+	}
+	if e.Created, err = documentTime(document["Created"]); err != nil {
+		return nil, fmt.Errorf("field Created: %w", err)
+	}
+	if e.Modified, err = documentTime(document["Modified"]); err != nil {
+		return nil, fmt.Errorf("field Modified: %w", err)
+	}
+	expires, err := documentInt(document["Expires"])
+	if err != nil {
+		return nil, fmt.Errorf("field Expires: %w", err)
+	}
+	e.Expires = int64(expires)
 
 	return e, nil
 }
+
+func documentInt(value interface{}) (int, error) {
+	switch value := value.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return value, nil
+	case int64:
+		return int(value), nil
+	case uint64:
+		return int(value), nil
+	case float64:
+		return int(value), nil
+	default:
+		return 0, fmt.Errorf("unexpected number %T", value)
+	}
+}
+
+func documentTime(value interface{}) (time.Time, error) {
+	switch value := value.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return value, nil
+	case string:
+		if value == "" {
+			return time.Time{}, nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil || t.IsZero() {
+			return time.Time{}, err
+		}
+		return t, nil
+	default:
+		return time.Time{}, fmt.Errorf("unexpected time %T", value)
+	}
+}
+
+// formatModified formats t as the Modified time of a map document.
+func formatModified(t time.Time) string {
+	return t.UTC().Format(ModifiedLayout)
+}
@@ -1,17 +1,162 @@
 package dynamodb
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
 	"github.com/Tanax/propagatedstorage"
 	"github.com/Tanax/propagatedstorage/documentstore"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	ddb "github.com/aws/aws-sdk-go/service/dynamodb"
 	"gocloud.dev/docstore/awsdynamodb"
 )
 
+const (
+	// DefaultTableName is the table opened when no table name is given.
+	DefaultTableName = "propagatedstorage"
+	// DefaultPartitionKey is the attribute holding the Type of models unless WithKeyAttributes says
+	// otherwise.
+	DefaultPartitionKey = documentstore.DefaultTypeField
+	// DefaultSortKey is the attribute holding the ID of models unless WithKeyAttributes says
+	// otherwise.
+	DefaultSortKey = documentstore.DefaultIDField
+	// TTLAttribute is the attribute the expiry of models is stored in, as a Unix time in seconds. Set
+	// it as the TableSpec.TTLAttribute to have DynamoDB delete expired models.
+	TTLAttribute = "Expires"
+)
+
+type options struct {
+	partitionKey   string
+	sortKey        string
+	endpoint       string
+	consistentRead bool
+	revisionField  string
+	codec          propagatedstorage.Codec
+	docstore       awsdynamodb.Options
+}
+
+// Option configures how tables are opened.
+type Option func(o *options)
+
+// WithKeyAttributes sets the partition and sort key attributes of the table, which hold the Type and
+// the ID of models. This adapts the datastore to existing tables.
+func WithKeyAttributes(partitionKey, sortKey string) Option {
+	return func(o *options) {
+		o.partitionKey = partitionKey
+		o.sortKey = sortKey
+	}
+}
+
+// WithCodec sets the codec serializing the items stored in tables. The Types stored must be registered
+// on it. Defaults to propagatedstorage.DefaultCodec.
+func WithCodec(codec propagatedstorage.Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+// WithEndpoint overrides the endpoint of the session, for instance to use DynamoDB Local.
+func WithEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.endpoint = endpoint
+	}
+}
+
+// WithConsistentReads makes reads strongly consistent, so they see every save acknowledged before
+// them, at twice the read capacity.
+func WithConsistentReads() Option {
+	return func(o *options) {
+		o.consistentRead = true
+	}
+}
+
+// WithRevisionField sets the attribute docstore keeps document revisions in. Defaults to
+// docstore.DefaultRevisionField.
+func WithRevisionField(field string) Option {
+	return func(o *options) {
+		o.revisionField = field
+	}
+}
+
+// WithDocstoreOptions sets the options the collections are opened with. WithConsistentReads and
+// WithRevisionField take precedence over them, whatever their order.
+func WithDocstoreOptions(opts awsdynamodb.Options) Option {
+	return func(o *options) {
+		o.docstore = opts
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		partitionKey: DefaultPartitionKey,
+		sortKey:      DefaultSortKey,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// Bootstrap opens a datastore for every table concurrently, as InitiateSync does. It returns the
+// datastores that could be opened by table name, and the errors of the others joined in a
+// propagatedstorage.Errors, in the order of tableNames. Opening a table is canceled when ctx is done,
+// failing with the error of ctx.
+func Bootstrap(ctx context.Context, sess *session.Session, tableNames []string, opts ...Option) (map[string]propagatedstorage.Datastore, error) {
+	type result struct {
+		tableName string
+		datastore propagatedstorage.Datastore
+		err       error
+	}
+
+	var unique []string
+	seen := make(map[string]bool, len(tableNames))
+	for _, tableName := range tableNames {
+		if !seen[tableName] {
+			seen[tableName] = true
+			unique = append(unique, tableName)
+		}
+	}
+
+	results := make(chan result, len(unique))
+	for _, tableName := range unique {
+		go func(tableName string) {
+			datastore, err := initiate(ctx, sess, tableName, opts)
+			results <- result{tableName: tableName, datastore: datastore, err: err}
+		}(tableName)
+	}
+
+	datastores := make(map[string]propagatedstorage.Datastore, len(unique))
+	failures := make(map[string]error)
+	for range unique {
+		r := <-results
+		if r.err != nil {
+			failures[r.tableName] = r.err
+			continue
+		}
+		datastores[r.tableName] = r.datastore
+	}
+
+	var errs propagatedstorage.Errors
+	for _, tableName := range unique {
+		if err, ok := failures[tableName]; ok {
+			errs = append(errs, fmt.Errorf("table %s: %w", tableName, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return datastores, errs
+	}
+	return datastores, nil
+}
+
 // InitiateAsync initializes a propagated storage datastore with a dynamo db driver asynchronously.
+//
+// Deprecated: use Bootstrap, which opens several tables concurrently and collects their errors safely.
 func InitiateAsync(sess *session.Session, datastore *propagatedstorage.Datastore, tableName string, errors *[]error, wg *sync.WaitGroup) {
 	docstore, err := InitiateSync(sess, tableName)
 	if err != nil {
@@ -23,20 +168,65 @@ func InitiateAsync(sess *session.Session, datastore *propagatedstorage.Datastore
 	wg.Done()
 }
 
-// InitiateSync initializes a propagated storage datastore with a dynamo db driver synchronously.
-func InitiateSync(sess *session.Session, tableName string) (propagatedstorage.Datastore, error) {
+// InitiateSync initializes a propagated storage datastore with a dynamo db driver synchronously. The
+// table defaults to DefaultTableName. The datastore is a propagatedstorage.Closer that closes the
+// collection it opened.
+//
+// Models are stored as map documents, with their items serialized by the codec set by WithCodec and
+// Modified formatted with the fixed-width documentstore.ModifiedLayout. Models saved by earlier
+// versions, which stored Modified with a variable width, must be saved again before List and
+// ChangedSince order them reliably.
+func InitiateSync(sess *session.Session, tableName string, opts ...Option) (propagatedstorage.Datastore, error) {
+	return initiate(context.Background(), sess, tableName, opts)
+}
+
+// openContextHandler is the name of the handler giving the table description requests of opening a
+// collection a context, which awsdynamodb.OpenCollection does not.
+const openContextHandler = "propagatedstorage.OpenContext"
+
+// initiate opens the table as InitiateSync does, canceling when ctx is done.
+func initiate(ctx context.Context, sess *session.Session, tableName string, opts []Option) (propagatedstorage.Datastore, error) {
 	if sess == nil {
 		return nil, fmt.Errorf("failed to open collection propagated storage: %w", propagatedstorage.ErrMissingDatastoreSession)
 	}
 
 	if tableName == "" {
-		tableName = "propagatedstorage"
+		tableName = DefaultTableName
 	}
 
-	driver, err := awsdynamodb.OpenCollection(ddb.New(sess), tableName, "Type", "ID", nil)
+	o := newOptions(opts)
+	config := aws.NewConfig()
+	if o.endpoint != "" {
+		config = config.WithEndpoint(o.endpoint)
+	}
+
+	docstoreOptions := o.docstore
+	if o.consistentRead {
+		docstoreOptions.ConsistentRead = true
+	}
+	if o.revisionField != "" {
+		docstoreOptions.RevisionField = o.revisionField
+	}
+
+	client := ddb.New(sess, config)
+	client.Handlers.Build.PushFrontNamed(request.NamedHandler{Name: openContextHandler, Fn: func(r *request.Request) {
+		if r.Operation.Name == "DescribeTable" {
+			r.SetContext(ctx)
+		}
+	}})
+	driver, err := awsdynamodb.OpenCollection(client, tableName, o.partitionKey, o.sortKey, &docstoreOptions)
+	client.Handlers.Build.RemoveByName(openContextHandler)
+	if ctx.Err() != nil && err != nil {
+		return nil, fmt.Errorf("failed to open collection propagated storage: %w", ctx.Err())
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to open collection propagated storage: %w", propagatedstorage.ErrInitiateDatastoreDriver.Wrap(err))
 	}
 
-	return documentstore.New(driver), nil
+	// Map documents store Modified with a fixed width, which the Modified index orders in time.
+	documentOptions := []documentstore.Option{documentstore.WithKeyFields(o.partitionKey, o.sortKey), documentstore.WithMapDocuments()}
+	if o.codec != nil {
+		documentOptions = append(documentOptions, documentstore.WithCodec(o.codec))
+	}
+	return documentstore.New(driver, documentOptions...), nil
 }
@@ -0,0 +1,347 @@
+package dynamodb_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/dynamodb"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/docstore/awsdynamodb"
+)
+
+// fakeDynamoDB answers DescribeTable for the tables it knows, after an optional delay per table, and
+// BatchGetItem and Query with no items. It records the requests of BatchGetItem and Query, and the
+// tables whose description was canceled by the client while delayed.
+type fakeDynamoDB struct {
+	mu       sync.Mutex
+	tables   map[string]time.Duration
+	gets     []map[string]interface{}
+	queries  []map[string]interface{}
+	canceled []string
+}
+
+func (f *fakeDynamoDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+
+	target := r.Header.Get("X-Amz-Target")
+	if strings.HasSuffix(target, ".BatchGetItem") {
+		var input struct {
+			RequestItems map[string]map[string]interface{}
+		}
+		json.NewDecoder(r.Body).Decode(&input)
+
+		responses := make(map[string][]interface{})
+		f.mu.Lock()
+		for table, get := range input.RequestItems {
+			f.gets = append(f.gets, get)
+			responses[table] = []interface{}{}
+		}
+		f.mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"Responses": responses})
+		return
+	}
+
+	if strings.HasSuffix(target, ".Query") {
+		var input map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&input)
+
+		f.mu.Lock()
+		f.queries = append(f.queries, input)
+		f.mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"Items": []interface{}{}, "Count": 0})
+		return
+	}
+
+	if !strings.HasSuffix(target, ".DescribeTable") {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.dynamodb.v20120810#UnknownOperationException"})
+		return
+	}
+
+	var input struct{ TableName string }
+	json.NewDecoder(r.Body).Decode(&input)
+
+	f.mu.Lock()
+	delay, ok := f.tables[input.TableName]
+	f.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"__type":  "com.amazonaws.dynamodb.v20120810#ResourceNotFoundException",
+			"message": "Requested resource not found: Table: " + input.TableName + " not found",
+		})
+		return
+	}
+
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		f.mu.Lock()
+		f.canceled = append(f.canceled, input.TableName)
+		f.mu.Unlock()
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"Table": map[string]interface{}{
+			"TableName":   input.TableName,
+			"TableStatus": "ACTIVE",
+			"KeySchema": []map[string]string{
+				{"AttributeName": "Type", "KeyType": "HASH"},
+				{"AttributeName": "ID", "KeyType": "RANGE"},
+			},
+		},
+	})
+}
+
+func newSession(t *testing.T, tables map[string]time.Duration) *session.Session {
+	sess, _ := newFakeSession(t, tables)
+	return sess
+}
+
+func newFakeSession(t *testing.T, tables map[string]time.Duration) (*session.Session, *fakeDynamoDB) {
+	fake := &fakeDynamoDB{tables: tables}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("eu-west-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	require.Nil(t, err)
+	return sess, fake
+}
+
+func (f *fakeDynamoDB) Gets() []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.gets
+}
+
+func (f *fakeDynamoDB) Canceled() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.canceled
+}
+
+func (f *fakeDynamoDB) Queries() []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.queries
+}
+
+func keys(datastores map[string]propagatedstorage.Datastore) []string {
+	names := make([]string, 0, len(datastores))
+	for name := range datastores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestInitiateSync_MissingSession(t *testing.T) {
+	// Apply
+	_, err := dynamodb.InitiateSync(nil, "table")
+
+	// Assert
+	assert.True(t, errors.Is(err, propagatedstorage.ErrMissingDatastoreSession))
+}
+
+func TestInitiateSync_Options(t *testing.T) {
+	// Setup
+	fake := &fakeDynamoDB{tables: map[string]time.Duration{"my-table": 0}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("eu-west-1"),
+		Endpoint:    aws.String("http://unreachable.invalid"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	require.Nil(t, err)
+
+	// Apply
+	datastore, err := dynamodb.InitiateSync(sess, "my-table",
+		dynamodb.WithEndpoint(server.URL),
+		dynamodb.WithKeyAttributes("pk", "sk"),
+		dynamodb.WithConsistentReads(),
+		dynamodb.WithDocstoreOptions(awsdynamodb.Options{AllowScans: true}),
+	)
+	require.Nil(t, err)
+	defer propagatedstorage.CloseAll(context.TODO(), datastore)
+	getErr := datastore.Get(context.TODO(), propagatedstorage.NewModel("ThisIsMyID", "MyType", 0))
+
+	// Assert
+	assert.True(t, errors.Is(getErr, propagatedstorage.ErrNotFound))
+	require.Len(t, fake.Gets(), 1)
+	request := fake.Gets()[0]
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"pk": map[string]interface{}{"S": "MyType"},
+		"sk": map[string]interface{}{"S": "ThisIsMyID"},
+	}}, request["Keys"])
+	assert.Equal(t, true, request["ConsistentRead"])
+}
+
+func TestList_Query(t *testing.T) {
+	// Setup
+	fake := &fakeDynamoDB{tables: map[string]time.Duration{"my-table": 0}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("eu-west-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	require.Nil(t, err)
+	datastore, err := dynamodb.InitiateSync(sess, "my-table", dynamodb.WithEndpoint(server.URL))
+	require.Nil(t, err)
+	defer propagatedstorage.CloseAll(context.TODO(), datastore)
+
+	// Apply
+	page, listErr := propagatedstorage.List(context.TODO(), datastore, "MyType", propagatedstorage.ListFilter{}, "")
+
+	// Assert
+	require.Nil(t, listErr)
+	assert.Empty(t, page.Models)
+	require.Len(t, fake.Queries(), 1)
+	values := fake.Queries()[0]["ExpressionAttributeValues"].(map[string]interface{})
+	for name, value := range values {
+		assert.NotContains(t, value, "NULL", "condition value %s must not be NULL", name)
+	}
+}
+
+func TestList_ModifiedFixedWidth(t *testing.T) {
+	// Setup
+	sess, fake := newFakeSession(t, map[string]time.Duration{"my-table": 0})
+	datastore, err := dynamodb.InitiateSync(sess, "my-table")
+	require.Nil(t, err)
+	defer propagatedstorage.CloseAll(context.TODO(), datastore)
+
+	// Apply
+	since := time.Date(2020, 1, 1, 12, 0, 5, 100000000, time.UTC)
+	_, listErr := propagatedstorage.List(context.TODO(), datastore, "MyType", propagatedstorage.ListFilter{ModifiedSince: since}, "")
+
+	// Assert
+	require.Nil(t, listErr)
+	require.Len(t, fake.Queries(), 1)
+	var compared []interface{}
+	for _, value := range fake.Queries()[0]["ExpressionAttributeValues"].(map[string]interface{}) {
+		compared = append(compared, value)
+	}
+	assert.Contains(t, compared, map[string]interface{}{"S": "2020-01-01T12:00:05.100000000Z"}, "Modified must be compared with a fixed width")
+}
+
+func TestBootstrap(t *testing.T) {
+	// Setup
+	sess := newSession(t, map[string]time.Duration{"first": 0, "second": 0, "third": 0})
+
+	// Apply
+	datastores, err := dynamodb.Bootstrap(context.TODO(), sess, []string{"first", "second", "third", "first"})
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"first", "second", "third"}, keys(datastores))
+	assert.Nil(t, propagatedstorage.CloseAll(context.TODO(), datastores["first"], datastores["second"], datastores["third"]))
+}
+
+func TestBootstrap_JoinsErrors(t *testing.T) {
+	// Setup
+	sess := newSession(t, map[string]time.Duration{"first": 0})
+
+	// Apply
+	datastores, err := dynamodb.Bootstrap(context.TODO(), sess, []string{"first", "missing", "another-missing"})
+
+	// Assert
+	assert.Equal(t, []string{"first"}, keys(datastores))
+
+	var errs propagatedstorage.Errors
+	require.True(t, errors.As(err, &errs))
+	require.Len(t, errs, 2)
+	assert.True(t, errors.Is(err, propagatedstorage.ErrInitiateDatastoreDriver))
+	assert.Contains(t, errs[0].Error(), "table missing", "errors must be in the order of the table names")
+	assert.Contains(t, errs[1].Error(), "table another-missing")
+}
+
+func TestBootstrap_HonoursContext(t *testing.T) {
+	// Setup
+	sess, fake := newFakeSession(t, map[string]time.Duration{"fast": 0, "slow": time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// Apply
+	start := time.Now()
+	datastores, err := dynamodb.Bootstrap(ctx, sess, []string{"fast", "slow"})
+
+	// Assert
+	assert.Less(t, int64(time.Since(start)), int64(time.Second), "Bootstrap must return when ctx is done")
+	assert.Equal(t, []string{"fast"}, keys(datastores))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Contains(t, err.Error(), "table slow")
+	propagatedstoragetest.Eventually(t, func() bool { return len(fake.Canceled()) == 1 }, "describing the slow table must be canceled")
+	assert.Equal(t, []string{"slow"}, fake.Canceled())
+}
+
+func TestInitiateAsync(t *testing.T) {
+	// Setup
+	var (
+		sess      = newSession(t, map[string]time.Duration{"my-table": 0})
+		datastore propagatedstorage.Datastore
+		errs      []error
+		wg        sync.WaitGroup
+	)
+
+	// Apply
+	wg.Add(1)
+	go dynamodb.InitiateAsync(sess, &datastore, "my-table", &errs, &wg)
+	wg.Wait()
+
+	// Assert
+	assert.Empty(t, errs)
+	assert.NotNil(t, datastore)
+	assert.Nil(t, propagatedstorage.CloseAll(context.TODO(), datastore))
+}
+
+func TestOpenDatastore_URL(t *testing.T) {
+	// Setup
+	server := httptest.NewServer(&fakeDynamoDB{tables: map[string]time.Duration{"my-table": 0}})
+	defer server.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	// Apply
+	datastore, err := propagatedstorage.OpenDatastore(context.TODO(), "dynamodb://my-table?region=eu-west-1&endpoint="+url.QueryEscape(server.URL))
+	_, missing := propagatedstorage.OpenDatastore(context.TODO(), "dynamodb://missing-table?region=eu-west-1&endpoint="+url.QueryEscape(server.URL))
+	_, unknown := propagatedstorage.OpenDatastore(context.TODO(), "dynamodb://my-table?regoin=eu-west-1")
+	_, halfKey := propagatedstorage.OpenDatastore(context.TODO(), "dynamodb://my-table?partition_key=pk")
+
+	// Assert
+	require.Nil(t, err)
+	assert.Nil(t, propagatedstorage.CloseAll(context.TODO(), datastore))
+	assert.True(t, errors.Is(missing, propagatedstorage.ErrInitiateDatastoreDriver))
+	assert.NotNil(t, unknown)
+	assert.NotNil(t, halfKey)
+}
@@ -0,0 +1,82 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Scheme is the URL scheme dynamodb registers on propagatedstorage.DefaultURLMux.
+const Scheme = "dynamodb"
+
+func init() {
+	propagatedstorage.DefaultURLMux().RegisterDatastore(Scheme, &URLOpener{})
+}
+
+// URLOpener opens the table named by the host of "dynamodb://table" URLs, as InitiateSync does. The
+// URL may set the "region" of the table and the "endpoint" of DynamoDB, such as the one of DynamoDB
+// Local, as well as the "partition_key" and "sort_key" attributes, "consistent_read" and the
+// "revision_field", as the Options of the same names do. Everything else, such as credentials, comes
+// from the session.
+type URLOpener struct {
+	// Session is the session the URL parameters are applied to. Defaults to a session configured from
+	// the environment.
+	Session *session.Session
+	// Codec serializes the items stored in tables. Defaults to propagatedstorage.DefaultCodec.
+	Codec propagatedstorage.Codec
+}
+
+// OpenDatastoreURL opens the table named by u.
+func (o *URLOpener) OpenDatastoreURL(ctx context.Context, u *url.URL) (propagatedstorage.Datastore, error) {
+	err := propagatedstorage.CheckURLParams(u, "region", "endpoint", "partition_key", "sort_key", "consistent_read", "revision_field")
+	if err != nil {
+		return nil, err
+	}
+
+	config := aws.NewConfig()
+	query := u.Query()
+	if region := query.Get("region"); region != "" {
+		config = config.WithRegion(region)
+	}
+
+	var opts []Option
+	if o.Codec != nil {
+		opts = append(opts, WithCodec(o.Codec))
+	}
+	if endpoint := query.Get("endpoint"); endpoint != "" {
+		opts = append(opts, WithEndpoint(endpoint))
+	}
+	if partitionKey, sortKey := query.Get("partition_key"), query.Get("sort_key"); partitionKey != "" || sortKey != "" {
+		if partitionKey == "" || sortKey == "" {
+			return nil, errors.New("partition_key and sort_key must be set together")
+		}
+		opts = append(opts, WithKeyAttributes(partitionKey, sortKey))
+	}
+	if consistentRead := query.Get("consistent_read"); consistentRead != "" {
+		consistent, err := strconv.ParseBool(consistentRead)
+		if err != nil {
+			return nil, fmt.Errorf("invalid consistent_read %q: %w", consistentRead, err)
+		}
+		if consistent {
+			opts = append(opts, WithConsistentReads())
+		}
+	}
+	if revisionField := query.Get("revision_field"); revisionField != "" {
+		opts = append(opts, WithRevisionField(revisionField))
+	}
+
+	sess := o.Session
+	if sess == nil {
+		if sess, err = session.NewSession(); err != nil {
+			return nil, err
+		}
+	}
+
+	return InitiateSync(sess.Copy(config), u.Host, opts...)
+}
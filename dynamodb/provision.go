@@ -0,0 +1,388 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	ddb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+const (
+	// ModifiedIndexName is the global secondary index of the models of a Type by Modified.
+	ModifiedIndexName = "Modified"
+	// VersionIndexName is the global secondary index of the models of a Type by Version.
+	VersionIndexName = "Version"
+)
+
+// pollInterval is how often Provision checks whether a table or index it changed is active.
+const pollInterval = time.Second
+
+// TableSpec describes the table a datastore expects.
+type TableSpec struct {
+	// TableName is the name of the table. Defaults to DefaultTableName.
+	TableName string
+	// PartitionKey and SortKey are the key attributes of the table, as set by WithKeyAttributes.
+	// They default to DefaultPartitionKey and DefaultSortKey.
+	PartitionKey string
+	SortKey      string
+
+	// BillingMode is ddb.BillingModePayPerRequest, the default, or ddb.BillingModeProvisioned, in
+	// which case the table and its indexes have ReadCapacity and WriteCapacity units.
+	BillingMode   string
+	ReadCapacity  int64
+	WriteCapacity int64
+
+	// TTLAttribute is the attribute DynamoDB expires items by. No TTL is expected if empty.
+	TTLAttribute string
+
+	// ModifiedIndex and VersionIndex add the global secondary indexes ModifiedIndexName and
+	// VersionIndexName, which order the models of a Type by Modified and Version. Datastores need the
+	// Modified index for propagatedstorage.ChangedSince.
+	ModifiedIndex bool
+	VersionIndex  bool
+}
+
+func (spec TableSpec) withDefaults() TableSpec {
+	if spec.TableName == "" {
+		spec.TableName = DefaultTableName
+	}
+	if spec.PartitionKey == "" {
+		spec.PartitionKey = DefaultPartitionKey
+	}
+	if spec.SortKey == "" {
+		spec.SortKey = DefaultSortKey
+	}
+	if spec.BillingMode == "" {
+		spec.BillingMode = ddb.BillingModePayPerRequest
+	}
+	return spec
+}
+
+// Drift is a difference between a table and its TableSpec that Provision does not fix itself, as
+// fixing it means recreating the table or is rate limited by DynamoDB.
+type Drift struct {
+	Field string
+	Want  string
+	Got   string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s: want %s, got %s", d.Field, d.Want, d.Got)
+}
+
+// ProvisionReport reports what Provision did to a table and the drift left.
+type ProvisionReport struct {
+	Created bool
+	Applied []string
+	Drift   []Drift
+}
+
+// Provision creates the table of spec if it does not exist, and otherwise adds the indexes and TTL it
+// lacks. It waits for the table and its indexes to be active. Any other difference is reported as
+// Drift and left as it is. Provisioning a table that matches spec changes nothing.
+func Provision(ctx context.Context, client dynamodbiface.DynamoDBAPI, spec TableSpec) (*ProvisionReport, error) {
+	spec = spec.withDefaults()
+	report := new(ProvisionReport)
+
+	table, err := describeTable(ctx, client, spec.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	if table == nil {
+		if _, err := client.CreateTableWithContext(ctx, spec.createTableInput()); err != nil {
+			return nil, fmt.Errorf("could not create table %s: %w", spec.TableName, err)
+		}
+		report.Created = true
+		report.Applied = append(report.Applied, "created table "+spec.TableName)
+	} else {
+		for _, index := range spec.indexes() {
+			if findIndex(table, *index.IndexName) != nil {
+				continue
+			}
+			if err := waitActive(ctx, client, spec.TableName); err != nil {
+				return nil, err
+			}
+			if _, err := client.UpdateTableWithContext(ctx, spec.createIndexInput(index)); err != nil {
+				return nil, fmt.Errorf("could not create index %s: %w", *index.IndexName, err)
+			}
+			report.Applied = append(report.Applied, "created index "+*index.IndexName)
+		}
+	}
+
+	if err := waitActive(ctx, client, spec.TableName); err != nil {
+		return nil, err
+	}
+
+	if spec.TTLAttribute != "" {
+		ttl, err := describeTTL(ctx, client, spec.TableName)
+		if err != nil {
+			return nil, err
+		}
+		if ttl.status == ddb.TimeToLiveStatusDisabled {
+			_, err := client.UpdateTimeToLiveWithContext(ctx, &ddb.UpdateTimeToLiveInput{
+				TableName: aws.String(spec.TableName),
+				TimeToLiveSpecification: &ddb.TimeToLiveSpecification{
+					AttributeName: aws.String(spec.TTLAttribute),
+					Enabled:       aws.Bool(true),
+				},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("could not enable TTL on %s: %w", spec.TTLAttribute, err)
+			}
+			report.Applied = append(report.Applied, "enabled TTL on "+spec.TTLAttribute)
+		}
+	}
+
+	if report.Drift, err = Verify(ctx, client, spec); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Verify reports how the table differs from spec without changing it. A missing table is reported
+// as a single Drift.
+func Verify(ctx context.Context, client dynamodbiface.DynamoDBAPI, spec TableSpec) ([]Drift, error) {
+	spec = spec.withDefaults()
+
+	table, err := describeTable(ctx, client, spec.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if table == nil {
+		return []Drift{{Field: "table", Want: spec.TableName, Got: "none"}}, nil
+	}
+
+	var drift []Drift
+	check := func(field, want, got string) {
+		if want != got {
+			drift = append(drift, Drift{Field: field, Want: want, Got: got})
+		}
+	}
+
+	check("partition key", spec.PartitionKey+" (S)", keyAttribute(table, table.KeySchema, ddb.KeyTypeHash))
+	check("sort key", spec.SortKey+" (S)", keyAttribute(table, table.KeySchema, ddb.KeyTypeRange))
+
+	billingMode := ddb.BillingModeProvisioned
+	if table.BillingModeSummary != nil && table.BillingModeSummary.BillingMode != nil {
+		billingMode = *table.BillingModeSummary.BillingMode
+	}
+	check("billing mode", spec.BillingMode, billingMode)
+	if spec.BillingMode == ddb.BillingModeProvisioned && billingMode == ddb.BillingModeProvisioned {
+		check("capacity", capacity(spec.ReadCapacity, spec.WriteCapacity), throughput(table.ProvisionedThroughput))
+	}
+
+	for _, want := range spec.indexes() {
+		name := *want.IndexName
+		got := findIndex(table, name)
+		if got == nil {
+			drift = append(drift, Drift{Field: "index " + name, Want: "present", Got: "none"})
+			continue
+		}
+		check("index "+name+" partition key", keyAttribute(table, want.KeySchema, ddb.KeyTypeHash), keyAttribute(table, got.KeySchema, ddb.KeyTypeHash))
+		check("index "+name+" sort key", keyAttribute(table, want.KeySchema, ddb.KeyTypeRange), keyAttribute(table, got.KeySchema, ddb.KeyTypeRange))
+	}
+
+	if spec.TTLAttribute != "" {
+		ttl, err := describeTTL(ctx, client, spec.TableName)
+		if err != nil {
+			return nil, err
+		}
+		got := "disabled"
+		if ttl.status != ddb.TimeToLiveStatusDisabled {
+			got = ttl.attribute
+		}
+		check("TTL attribute", spec.TTLAttribute, got)
+	}
+
+	return drift, nil
+}
+
+func (spec TableSpec) createTableInput() *ddb.CreateTableInput {
+	input := &ddb.CreateTableInput{
+		TableName:   aws.String(spec.TableName),
+		BillingMode: aws.String(spec.BillingMode),
+		KeySchema: []*ddb.KeySchemaElement{
+			{AttributeName: aws.String(spec.PartitionKey), KeyType: aws.String(ddb.KeyTypeHash)},
+			{AttributeName: aws.String(spec.SortKey), KeyType: aws.String(ddb.KeyTypeRange)},
+		},
+		AttributeDefinitions:   spec.attributeDefinitions(),
+		GlobalSecondaryIndexes: spec.indexes(),
+	}
+	if spec.BillingMode == ddb.BillingModeProvisioned {
+		input.ProvisionedThroughput = spec.throughput()
+	}
+	return input
+}
+
+func (spec TableSpec) createIndexInput(index *ddb.GlobalSecondaryIndex) *ddb.UpdateTableInput {
+	return &ddb.UpdateTableInput{
+		TableName:            aws.String(spec.TableName),
+		AttributeDefinitions: spec.attributeDefinitions(),
+		GlobalSecondaryIndexUpdates: []*ddb.GlobalSecondaryIndexUpdate{{
+			Create: &ddb.CreateGlobalSecondaryIndexAction{
+				IndexName:             index.IndexName,
+				KeySchema:             index.KeySchema,
+				Projection:            index.Projection,
+				ProvisionedThroughput: index.ProvisionedThroughput,
+			},
+		}},
+	}
+}
+
+func (spec TableSpec) attributeDefinitions() []*ddb.AttributeDefinition {
+	definitions := []*ddb.AttributeDefinition{
+		{AttributeName: aws.String(spec.PartitionKey), AttributeType: aws.String(ddb.ScalarAttributeTypeS)},
+		{AttributeName: aws.String(spec.SortKey), AttributeType: aws.String(ddb.ScalarAttributeTypeS)},
+	}
+	if spec.ModifiedIndex {
+		definitions = append(definitions, &ddb.AttributeDefinition{AttributeName: aws.String("Modified"), AttributeType: aws.String(ddb.ScalarAttributeTypeS)})
+	}
+	if spec.VersionIndex {
+		definitions = append(definitions, &ddb.AttributeDefinition{AttributeName: aws.String("Version"), AttributeType: aws.String(ddb.ScalarAttributeTypeN)})
+	}
+	return definitions
+}
+
+// indexes returns the global secondary indexes of spec. Modified is stored as a string with the
+// fixed-width documentstore.ModifiedLayout and Version as a number, which both sort in order. Models
+// saved before Modified had a fixed width must be saved again to sort in order.
+func (spec TableSpec) indexes() []*ddb.GlobalSecondaryIndex {
+	var indexes []*ddb.GlobalSecondaryIndex
+	add := func(name, sortKey string) {
+		index := &ddb.GlobalSecondaryIndex{
+			IndexName: aws.String(name),
+			KeySchema: []*ddb.KeySchemaElement{
+				{AttributeName: aws.String(spec.PartitionKey), KeyType: aws.String(ddb.KeyTypeHash)},
+				{AttributeName: aws.String(sortKey), KeyType: aws.String(ddb.KeyTypeRange)},
+			},
+			Projection: &ddb.Projection{ProjectionType: aws.String(ddb.ProjectionTypeAll)},
+		}
+		if spec.BillingMode == ddb.BillingModeProvisioned {
+			index.ProvisionedThroughput = spec.throughput()
+		}
+		indexes = append(indexes, index)
+	}
+
+	if spec.ModifiedIndex {
+		add(ModifiedIndexName, "Modified")
+	}
+	if spec.VersionIndex {
+		add(VersionIndexName, "Version")
+	}
+	return indexes
+}
+
+func (spec TableSpec) throughput() *ddb.ProvisionedThroughput {
+	return &ddb.ProvisionedThroughput{
+		ReadCapacityUnits:  aws.Int64(spec.ReadCapacity),
+		WriteCapacityUnits: aws.Int64(spec.WriteCapacity),
+	}
+}
+
+// describeTable returns the description of the table, or nil if it does not exist.
+func describeTable(ctx context.Context, client dynamodbiface.DynamoDBAPI, tableName string) (*ddb.TableDescription, error) {
+	out, err := client.DescribeTableWithContext(ctx, &ddb.DescribeTableInput{TableName: aws.String(tableName)})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == ddb.ErrCodeResourceNotFoundException {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not describe table %s: %w", tableName, err)
+	}
+	return out.Table, nil
+}
+
+type ttlDescription struct {
+	status    string
+	attribute string
+}
+
+func describeTTL(ctx context.Context, client dynamodbiface.DynamoDBAPI, tableName string) (ttlDescription, error) {
+	out, err := client.DescribeTimeToLiveWithContext(ctx, &ddb.DescribeTimeToLiveInput{TableName: aws.String(tableName)})
+	if err != nil {
+		return ttlDescription{}, fmt.Errorf("could not describe TTL of %s: %w", tableName, err)
+	}
+
+	ttl := ttlDescription{status: ddb.TimeToLiveStatusDisabled}
+	if description := out.TimeToLiveDescription; description != nil {
+		ttl.status = aws.StringValue(description.TimeToLiveStatus)
+		ttl.attribute = aws.StringValue(description.AttributeName)
+	}
+	return ttl, nil
+}
+
+// waitActive waits until the table and all its indexes are active.
+func waitActive(ctx context.Context, client dynamodbiface.DynamoDBAPI, tableName string) error {
+	for {
+		table, err := describeTable(ctx, client, tableName)
+		if err != nil {
+			return err
+		}
+		if table != nil && active(table) {
+			return nil
+		}
+
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return fmt.Errorf("table %s did not become active: %w", tableName, ctx.Err())
+		}
+	}
+}
+
+func active(table *ddb.TableDescription) bool {
+	if aws.StringValue(table.TableStatus) != ddb.TableStatusActive {
+		return false
+	}
+	for _, index := range table.GlobalSecondaryIndexes {
+		if aws.StringValue(index.IndexStatus) != ddb.IndexStatusActive {
+			return false
+		}
+	}
+	return true
+}
+
+func findIndex(table *ddb.TableDescription, name string) *ddb.GlobalSecondaryIndexDescription {
+	for _, index := range table.GlobalSecondaryIndexes {
+		if aws.StringValue(index.IndexName) == name {
+			return index
+		}
+	}
+	return nil
+}
+
+// keyAttribute describes the attribute of keySchema with keyType as "name (type)", with the type
+// looked up in the attribute definitions of table, or returns "none".
+func keyAttribute(table *ddb.TableDescription, keySchema []*ddb.KeySchemaElement, keyType string) string {
+	for _, element := range keySchema {
+		if aws.StringValue(element.KeyType) != keyType {
+			continue
+		}
+		name := aws.StringValue(element.AttributeName)
+		for _, definition := range table.AttributeDefinitions {
+			if aws.StringValue(definition.AttributeName) == name {
+				return fmt.Sprintf("%s (%s)", name, aws.StringValue(definition.AttributeType))
+			}
+		}
+		return name
+	}
+	return "none"
+}
+
+func throughput(throughput *ddb.ProvisionedThroughputDescription) string {
+	if throughput == nil {
+		return capacity(0, 0)
+	}
+	return capacity(aws.Int64Value(throughput.ReadCapacityUnits), aws.Int64Value(throughput.WriteCapacityUnits))
+}
+
+func capacity(read, write int64) string {
+	return strconv.FormatInt(read, 10) + " read/" + strconv.FormatInt(write, 10) + " write units"
+}
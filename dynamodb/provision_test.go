@@ -0,0 +1,265 @@
+package dynamodb_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tanax/propagatedstorage/dynamodb"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	ddb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTables keeps table descriptions in memory and answers the calls Provision makes. Tables and
+// indexes are active as soon as they are created.
+type fakeTables struct {
+	mu     sync.Mutex
+	tables map[string]*ddb.TableDescription
+	ttls   map[string]*ddb.TimeToLiveDescription
+	calls  []string
+}
+
+func (f *fakeTables) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	operation := r.Header.Get("X-Amz-Target")
+	operation = operation[strings.LastIndex(operation, ".")+1:]
+	f.calls = append(f.calls, operation)
+
+	var input struct {
+		ddb.CreateTableInput
+		GlobalSecondaryIndexUpdates []*ddb.GlobalSecondaryIndexUpdate
+		TimeToLiveSpecification     *ddb.TimeToLiveSpecification
+	}
+	json.NewDecoder(r.Body).Decode(&input)
+	tableName := aws.StringValue(input.TableName)
+	table, ok := f.tables[tableName]
+
+	if !ok && operation != "CreateTable" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"__type":  "com.amazonaws.dynamodb.v20120810#ResourceNotFoundException",
+			"message": "Requested resource not found",
+		})
+		return
+	}
+
+	switch operation {
+	case "CreateTable":
+		table = &ddb.TableDescription{
+			TableName:            input.TableName,
+			TableStatus:          aws.String(ddb.TableStatusActive),
+			KeySchema:            input.KeySchema,
+			AttributeDefinitions: input.AttributeDefinitions,
+			BillingModeSummary:   &ddb.BillingModeSummary{BillingMode: input.BillingMode},
+		}
+		if input.ProvisionedThroughput != nil {
+			table.ProvisionedThroughput = &ddb.ProvisionedThroughputDescription{
+				ReadCapacityUnits:  input.ProvisionedThroughput.ReadCapacityUnits,
+				WriteCapacityUnits: input.ProvisionedThroughput.WriteCapacityUnits,
+			}
+		}
+		for _, index := range input.GlobalSecondaryIndexes {
+			table.GlobalSecondaryIndexes = append(table.GlobalSecondaryIndexes, &ddb.GlobalSecondaryIndexDescription{
+				IndexName:   index.IndexName,
+				IndexStatus: aws.String(ddb.IndexStatusActive),
+				KeySchema:   index.KeySchema,
+			})
+		}
+		f.tables[tableName] = table
+		json.NewEncoder(w).Encode(ddb.CreateTableOutput{TableDescription: table})
+	case "UpdateTable":
+		table.AttributeDefinitions = input.AttributeDefinitions
+		for _, update := range input.GlobalSecondaryIndexUpdates {
+			table.GlobalSecondaryIndexes = append(table.GlobalSecondaryIndexes, &ddb.GlobalSecondaryIndexDescription{
+				IndexName:   update.Create.IndexName,
+				IndexStatus: aws.String(ddb.IndexStatusActive),
+				KeySchema:   update.Create.KeySchema,
+			})
+		}
+		json.NewEncoder(w).Encode(ddb.UpdateTableOutput{TableDescription: table})
+	case "DescribeTable":
+		json.NewEncoder(w).Encode(ddb.DescribeTableOutput{Table: table})
+	case "DescribeTimeToLive":
+		ttl := f.ttls[tableName]
+		if ttl == nil {
+			ttl = &ddb.TimeToLiveDescription{TimeToLiveStatus: aws.String(ddb.TimeToLiveStatusDisabled)}
+		}
+		json.NewEncoder(w).Encode(ddb.DescribeTimeToLiveOutput{TimeToLiveDescription: ttl})
+	case "UpdateTimeToLive":
+		f.ttls[tableName] = &ddb.TimeToLiveDescription{
+			AttributeName:    input.TimeToLiveSpecification.AttributeName,
+			TimeToLiveStatus: aws.String(ddb.TimeToLiveStatusEnabled),
+		}
+		json.NewEncoder(w).Encode(ddb.UpdateTimeToLiveOutput{TimeToLiveSpecification: input.TimeToLiveSpecification})
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.dynamodb.v20120810#UnknownOperationException"})
+	}
+}
+
+// Calls returns the operations called since the last call of Calls.
+func (f *fakeTables) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	calls := f.calls
+	f.calls = nil
+	return calls
+}
+
+func newFakeTables(t *testing.T) (*fakeTables, *ddb.DynamoDB) {
+	fake := &fakeTables{
+		tables: make(map[string]*ddb.TableDescription),
+		ttls:   make(map[string]*ddb.TimeToLiveDescription),
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	return fake, newClient(t, server.URL)
+}
+
+func newClient(t *testing.T, endpoint string) *ddb.DynamoDB {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("eu-west-1"),
+		Endpoint:    aws.String(endpoint),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	require.Nil(t, err)
+	return ddb.New(sess)
+}
+
+func TestProvision_CreatesTable(t *testing.T) {
+	// Setup
+	var (
+		ctx          = context.TODO()
+		fake, client = newFakeTables(t)
+		spec         = dynamodb.TableSpec{TTLAttribute: "Expires", ModifiedIndex: true, VersionIndex: true}
+	)
+
+	// Apply
+	created, createErr := dynamodb.Provision(ctx, client, spec)
+	fake.Calls()
+	again, againErr := dynamodb.Provision(ctx, client, spec)
+
+	// Assert
+	require.Nil(t, createErr)
+	assert.True(t, created.Created)
+	assert.Equal(t, []string{"created table propagatedstorage", "enabled TTL on Expires"}, created.Applied)
+	assert.Empty(t, created.Drift)
+
+	require.Nil(t, againErr)
+	assert.False(t, again.Created)
+	assert.Empty(t, again.Applied, "provisioning a provisioned table must change nothing")
+	assert.Empty(t, again.Drift)
+	for _, call := range fake.Calls() {
+		assert.True(t, strings.HasPrefix(call, "Describe"), "unexpected call %s", call)
+	}
+}
+
+func TestProvision_AddsIndexesAndTTL(t *testing.T) {
+	// Setup
+	ctx := context.TODO()
+	_, client := newFakeTables(t)
+	_, err := dynamodb.Provision(ctx, client, dynamodb.TableSpec{TableName: "my-table"})
+	require.Nil(t, err)
+
+	// Apply
+	report, err := dynamodb.Provision(ctx, client, dynamodb.TableSpec{TableName: "my-table", TTLAttribute: "Expires", ModifiedIndex: true, VersionIndex: true})
+
+	// Assert
+	require.Nil(t, err)
+	assert.False(t, report.Created)
+	assert.Equal(t, []string{"created index Modified", "created index Version", "enabled TTL on Expires"}, report.Applied)
+	assert.Empty(t, report.Drift)
+}
+
+func TestProvision_ReportsDrift(t *testing.T) {
+	// Setup
+	ctx := context.TODO()
+	_, client := newFakeTables(t)
+	_, err := dynamodb.Provision(ctx, client, dynamodb.TableSpec{
+		TableName:     "my-table",
+		PartitionKey:  "pk",
+		SortKey:       "sk",
+		BillingMode:   ddb.BillingModeProvisioned,
+		ReadCapacity:  5,
+		WriteCapacity: 5,
+		TTLAttribute:  "ttl",
+	})
+	require.Nil(t, err)
+
+	// Apply
+	report, err := dynamodb.Provision(ctx, client, dynamodb.TableSpec{TableName: "my-table", TTLAttribute: "Expires"})
+
+	// Assert
+	require.Nil(t, err)
+	assert.Empty(t, report.Applied, "drift must not be fixed")
+	assert.Equal(t, []dynamodb.Drift{
+		{Field: "partition key", Want: "Type (S)", Got: "pk (S)"},
+		{Field: "sort key", Want: "ID (S)", Got: "sk (S)"},
+		{Field: "billing mode", Want: ddb.BillingModePayPerRequest, Got: ddb.BillingModeProvisioned},
+		{Field: "TTL attribute", Want: "Expires", Got: "ttl"},
+	}, report.Drift)
+}
+
+func TestVerify_MissingTable(t *testing.T) {
+	// Setup
+	fake, client := newFakeTables(t)
+
+	// Apply
+	drift, err := dynamodb.Verify(context.TODO(), client, dynamodb.TableSpec{})
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, []dynamodb.Drift{{Field: "table", Want: "propagatedstorage", Got: "none"}}, drift)
+	assert.Equal(t, []string{"DescribeTable"}, fake.Calls(), "Verify must not change anything")
+}
+
+// TestProvision_DynamoDBLocal provisions a table in the DynamoDB Local at DYNAMODB_LOCAL_ENDPOINT,
+// such as http://localhost:8000.
+func TestProvision_DynamoDBLocal(t *testing.T) {
+	endpoint := os.Getenv("DYNAMODB_LOCAL_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("DYNAMODB_LOCAL_ENDPOINT is not set")
+	}
+
+	// Setup
+	var (
+		ctx    = context.TODO()
+		client = newClient(t, endpoint)
+		spec   = dynamodb.TableSpec{
+			TableName:     fmt.Sprintf("propagatedstorage-%d", time.Now().UnixNano()),
+			ModifiedIndex: true,
+			VersionIndex:  true,
+		}
+	)
+	defer client.DeleteTable(&ddb.DeleteTableInput{TableName: aws.String(spec.TableName)})
+
+	// Apply
+	created, createErr := dynamodb.Provision(ctx, client, spec)
+	again, againErr := dynamodb.Provision(ctx, client, spec)
+
+	// Assert
+	require.Nil(t, createErr)
+	assert.True(t, created.Created)
+	assert.Empty(t, created.Drift)
+	require.Nil(t, againErr)
+	assert.Empty(t, again.Applied)
+	assert.Empty(t, again.Drift)
+}
@@ -2,33 +2,25 @@ package propagatedstorage
 
 import (
 	"fmt"
+	"strings"
 )
 
-// BaseError ..
+// BaseError is an immutable sentinel describing a kind of failure. Sentinels never hold a cause
+// themselves; Wrap returns a new error instead, so they are safe to share between goroutines.
 type BaseError struct {
-	err error
 	msg string
 }
 
 func (e *BaseError) Error() string {
-	if e.err != nil {
-		return fmt.Sprintf("%s: %s", e.msg, e.err.Error())
-	}
 	return e.msg
 }
 
-// Unwrap ..
-func (e *BaseError) Unwrap() error {
-	return e.err
-}
-
-// Wrap ..
-func (e *BaseError) Wrap(err error) *BaseError {
-	e.err = err
-	return e
+// Wrap returns a new error of this kind wrapping err. The sentinel is left untouched.
+func (e *BaseError) Wrap(err error) *Error {
+	return &Error{Kind: e, Err: err}
 }
 
-// NewError ..
+// NewError creates a new sentinel error with the given message.
 func NewError(message string) *BaseError {
 	err := new(BaseError)
 	err.msg = message
@@ -36,6 +28,84 @@ func NewError(message string) *BaseError {
 	return err
 }
 
+// Stage names the step of a storage operation an error originated from.
+type Stage string
+
+const (
+	// StageDatastoreGet is the read of the propagated model from the datastore.
+	StageDatastoreGet Stage = "datastore.get"
+	// StageDatastoreSave is the write of the propagated model to the datastore.
+	StageDatastoreSave Stage = "datastore.save"
+	// StageVersionCheck is the comparison of the stored version against the required version.
+	StageVersionCheck Stage = "version.check"
+	// StageFallback is the call to the fallback service.
+	StageFallback Stage = "fallback"
+	// StageWriteBack is the write of an item fetched from the fallback service back to the datastore.
+	StageWriteBack Stage = "writeback"
+	// StagePopulate is the population of the caller's item from the propagated item.
+	StagePopulate Stage = "populate"
+	// StageNegativeCache is the lookup of IDs the fallback service recently reported as not found.
+	StageNegativeCache Stage = "negativecache"
+)
+
+// Error is a propagated storage error carrying the context it occurred in. It matches its Kind
+// with errors.Is and errors.As, and unwraps to its cause.
+type Error struct {
+	Kind            *BaseError
+	Type            Type
+	ID              string
+	Stage           Stage
+	RequiredVersion int
+	StoredVersion   int
+	Err             error
+}
+
+func (e *Error) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Kind.Error())
+
+	var fields []string
+	if e.Type != "" {
+		fields = append(fields, fmt.Sprintf("type=%s", e.Type))
+	}
+	if e.ID != "" {
+		fields = append(fields, fmt.Sprintf("id=%s", e.ID))
+	}
+	if e.Stage != "" {
+		fields = append(fields, fmt.Sprintf("stage=%s", e.Stage))
+	}
+	if e.RequiredVersion != 0 || e.StoredVersion != 0 {
+		fields = append(fields, fmt.Sprintf("required=%d", e.RequiredVersion), fmt.Sprintf("stored=%d", e.StoredVersion))
+	}
+	if len(fields) > 0 {
+		fmt.Fprintf(&sb, " [%s]", strings.Join(fields, " "))
+	}
+
+	if e.Err != nil {
+		fmt.Fprintf(&sb, ": %s", e.Err.Error())
+	}
+	return sb.String()
+}
+
+// Unwrap returns the cause of the error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the sentinel this error is a kind of.
+func (e *Error) Is(target error) bool {
+	return target == error(e.Kind)
+}
+
+// As sets a **BaseError target to the kind of this error.
+func (e *Error) As(target interface{}) bool {
+	if kind, ok := target.(**BaseError); ok {
+		*kind = e.Kind
+		return true
+	}
+	return false
+}
+
 var (
 	// ErrVersionOutdated ..
 	ErrVersionOutdated = NewError("version outdated")
@@ -51,4 +121,14 @@ var (
 	ErrInitiateDatastoreDriver = NewError("failed to initiate driver")
 	// ErrFetchItemFromService ..
 	ErrFetchItemFromService = NewError("failed to fetch item from fallback service")
+	// ErrUnknownType ..
+	ErrUnknownType = NewError("unknown type")
+	// ErrMissingDatastore ..
+	ErrMissingDatastore = NewError("missing datastore")
+	// ErrNotFound ..
+	ErrNotFound = NewError("not found")
+	// ErrUnsupported ..
+	ErrUnsupported = NewError("unsupported")
+	// ErrInvalidPageToken ..
+	ErrInvalidPageToken = NewError("invalid page token")
 )
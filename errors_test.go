@@ -0,0 +1,93 @@
+package propagatedstorage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingDatastore struct{}
+
+func (ds *failingDatastore) Get(ctx context.Context, model *propagatedstorage.Model) error {
+	return fmt.Errorf("failed to get %s", model.ID)
+}
+
+func (ds *failingDatastore) Save(ctx context.Context, model *propagatedstorage.Model) error {
+	return fmt.Errorf("failed to save %s", model.ID)
+}
+
+func TestWrap_DoesNotMutateSentinel(t *testing.T) {
+	// Setup
+	cause := errors.New("error")
+
+	// Apply
+	err := propagatedstorage.ErrDatastoreFailed.Wrap(cause)
+
+	// Assert
+	assert.True(t, errors.Is(err, propagatedstorage.ErrDatastoreFailed))
+	assert.True(t, errors.Is(err, cause))
+	assert.Nil(t, errors.Unwrap(propagatedstorage.ErrDatastoreFailed))
+	assert.EqualError(t, propagatedstorage.ErrDatastoreFailed, "datastore failed")
+}
+
+func TestError_Context(t *testing.T) {
+	// Setup
+	err := propagatedstorage.ErrVersionOutdated.Wrap(nil)
+	err.Type = TestType
+	err.ID = "ThisIsMyID"
+	err.Stage = propagatedstorage.StageVersionCheck
+	err.RequiredVersion = 2
+	err.StoredVersion = 1
+
+	// Apply
+	wrapped := fmt.Errorf("outer: %w", err)
+
+	// Assert
+	var target *propagatedstorage.Error
+	assert.True(t, errors.As(wrapped, &target))
+	assert.Equal(t, TestType, target.Type)
+	assert.Equal(t, "ThisIsMyID", target.ID)
+	assert.Equal(t, propagatedstorage.StageVersionCheck, target.Stage)
+
+	var kind *propagatedstorage.BaseError
+	assert.True(t, errors.As(wrapped, &kind))
+	assert.Equal(t, propagatedstorage.ErrVersionOutdated, kind)
+
+	assert.False(t, errors.Is(wrapped, propagatedstorage.ErrDatastoreFailed))
+	assert.EqualError(t, wrapped, "outer: version outdated [type=TestType id=ThisIsMyID stage=version.check required=2 stored=1]")
+}
+
+func TestGet_ConcurrentErrorsKeepTheirCause(t *testing.T) {
+	// Setup
+	var (
+		ctx     = context.TODO()
+		service = propagatedstorage.NewService(&failingDatastore{}, TestType, 0, nil)
+		wg      sync.WaitGroup
+		errs    = make([]error, 50)
+	)
+
+	// Apply
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = service.Get(ctx, &TestItem{ID: fmt.Sprintf("ID%d", i)})
+		}(i)
+	}
+	wg.Wait()
+
+	// Assert
+	for i, err := range errs {
+		var target *propagatedstorage.Error
+		assert.True(t, errors.As(err, &target))
+		assert.True(t, errors.Is(err, propagatedstorage.ErrDatastoreFailed))
+		assert.Equal(t, propagatedstorage.StageDatastoreGet, target.Stage)
+		assert.Equal(t, fmt.Sprintf("ID%d", i), target.ID)
+		assert.EqualError(t, target.Unwrap(), fmt.Sprintf("failed to get ID%d", i))
+	}
+}
@@ -0,0 +1,105 @@
+package propagatedstorage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/memstore"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expiringItem is a test item setting its own expiry.
+type expiringItem struct {
+	*propagatedstoragetest.Item
+	expires time.Time
+}
+
+func (i *expiringItem) GetExpires() time.Time {
+	return i.expires
+}
+
+func TestGet_ExpiredItemIsMiss(t *testing.T) {
+	// Setup
+	var (
+		ctx   = context.TODO()
+		start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		now   = &clock{now: start}
+		// The datastore keeps expired models, as DynamoDB does until it gets to delete them.
+		datastore = memstore.New(memstore.WithClock(func() time.Time { return start }))
+		fallback  = propagatedstoragetest.NewFakeService()
+		observer  = &TestObserver{}
+		service   = propagatedstorage.NewService(datastore, TestType, 0, fallback, propagatedstorage.WithExpiry(time.Minute), propagatedstorage.WithClock(now.Now), propagatedstorage.WithObserver(observer))
+	)
+	require.Nil(t, service.Save(ctx, propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 1, "Saved")))
+	fallback.SetItem(propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 2, "From owner"))
+
+	// Apply
+	fresh := propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 0, "")
+	freshErr := service.Get(ctx, fresh)
+
+	now.now = start.Add(time.Minute)
+	expired := propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 0, "")
+	expiredErr := service.Get(ctx, expired)
+
+	// Assert
+	assert.Nil(t, freshErr)
+	assert.Equal(t, "Saved", fresh.Payload)
+	assert.Nil(t, expiredErr)
+	assert.Equal(t, "From owner", expired.Payload, "expired items must be fetched from the fallback service")
+	assert.Equal(t, propagatedstorage.OutcomeExpired, observer.Outcomes()[propagatedstorage.StageDatastoreGet])
+
+	stored := propagatedstorage.NewModel("ThisIsMyID", TestType, 0)
+	require.Nil(t, datastore.Get(ctx, stored))
+	assert.Equal(t, start.Add(2*time.Minute), stored.Expires, "the written back item must expire anew")
+}
+
+func TestGet_ExpiredItemIsNotTombstone(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		start     = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		now       = &clock{now: start}
+		datastore = memstore.New(memstore.WithClock(func() time.Time { return start }))
+		fallback  = propagatedstoragetest.NewFakeService()
+		service   = propagatedstorage.NewService(datastore, TestType, 0, fallback,
+			propagatedstorage.WithExpiry(time.Minute),
+			propagatedstorage.WithPersistedNegativeCache(time.Hour),
+			propagatedstorage.WithClock(now.Now),
+		)
+	)
+	require.Nil(t, service.Save(ctx, propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 1, "Saved")))
+	fallback.SetItem(propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 2, "From owner"))
+
+	// Apply
+	now.now = start.Add(time.Minute)
+	item := propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 0, "")
+	err := service.Get(ctx, item)
+
+	// Assert
+	assert.Nil(t, err, "expired items must not be taken for tombstones")
+	assert.Equal(t, "From owner", item.Payload)
+	assert.Len(t, fallback.Calls(), 1)
+}
+
+func TestSave_ExpiringItem(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		expires   = time.Now().Add(time.Hour).Truncate(time.Second)
+		datastore = memstore.New()
+		service   = propagatedstorage.NewService(datastore, TestType, 0, nil, propagatedstorage.WithExpiry(time.Minute))
+	)
+
+	// Apply
+	err := service.Save(ctx, &expiringItem{Item: propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 1, ""), expires: expires})
+
+	// Assert
+	assert.Nil(t, err)
+	stored := propagatedstorage.NewModel("ThisIsMyID", TestType, 0)
+	require.Nil(t, datastore.Get(ctx, stored))
+	assert.Equal(t, expires, stored.Expires, "the expiry of the item must override the one of the service")
+}
@@ -4,6 +4,9 @@ go 1.13
 
 require (
 	github.com/aws/aws-sdk-go v1.19.45
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/stretchr/testify v1.4.0
+	go.etcd.io/bbolt v1.3.6
+	go.opencensus.io v0.22.0
 	gocloud.dev v0.17.0
 )
@@ -0,0 +1,164 @@
+package propagatedstorage
+
+import (
+	"context"
+	"time"
+)
+
+// Operation names a call that can be intercepted.
+type Operation string
+
+const (
+	// OperationServiceGet is a call to Service.Get.
+	OperationServiceGet Operation = "Service.Get"
+	// OperationServiceSave is a call to Service.Save.
+	OperationServiceSave Operation = "Service.Save"
+	// OperationDatastoreGet is a call to Datastore.Get.
+	OperationDatastoreGet Operation = "Datastore.Get"
+	// OperationDatastoreSave is a call to Datastore.Save.
+	OperationDatastoreSave Operation = "Datastore.Save"
+	// OperationDatastoreDelete is a call to Deleter.Delete.
+	OperationDatastoreDelete Operation = "Datastore.Delete"
+)
+
+// Call describes an intercepted call. Item is set for service operations and Model for datastore
+// operations; an interceptor may replace either before passing the call on.
+type Call struct {
+	Type      Type
+	ID        string
+	Operation Operation
+	Item      Item
+	Model     *Model
+}
+
+// Handler performs a call.
+type Handler func(ctx context.Context, call *Call) error
+
+// Interceptor intercepts a call. It sees the call before passing it on to next and the result after,
+// and may short-circuit the call by returning without calling next at all.
+type Interceptor func(ctx context.Context, call *Call, next Handler) error
+
+// Chain combines interceptors into a single interceptor. The first interceptor is the outermost one,
+// so it sees the call first and the result last.
+func Chain(interceptors ...Interceptor) Interceptor {
+	return func(ctx context.Context, call *Call, next Handler) error {
+		return chainHandler(interceptors, next)(ctx, call)
+	}
+}
+
+func chainHandler(interceptors []Interceptor, final Handler) Handler {
+	handler := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, call *Call) error {
+			return interceptor(ctx, call, next)
+		}
+	}
+	return handler
+}
+
+type interceptedService struct {
+	service  Service
+	itemType Type
+	get      Handler
+	save     Handler
+}
+
+// InterceptService returns a Service that runs every call through the interceptors before it reaches
+// service. itemType is the Type service is bound to and is reported on every call.
+func InterceptService(service Service, itemType Type, interceptors ...Interceptor) Service {
+	s := &interceptedService{
+		service:  service,
+		itemType: itemType,
+	}
+
+	s.get = chainHandler(interceptors, func(ctx context.Context, call *Call) error {
+		return s.service.Get(ctx, call.Item)
+	})
+	s.save = chainHandler(interceptors, func(ctx context.Context, call *Call) error {
+		return s.service.Save(ctx, call.Item)
+	})
+
+	return s
+}
+
+func (s *interceptedService) Get(ctx context.Context, item Item) error {
+	return s.get(ctx, &Call{Type: s.itemType, ID: item.GetID(), Operation: OperationServiceGet, Item: item})
+}
+
+func (s *interceptedService) Save(ctx context.Context, item Item) error {
+	return s.save(ctx, &Call{Type: s.itemType, ID: item.GetID(), Operation: OperationServiceSave, Item: item})
+}
+
+// Close closes the wrapped service. Closing is not intercepted.
+func (s *interceptedService) Close(ctx context.Context) error {
+	return CloseAll(ctx, s.service)
+}
+
+type interceptedDatastore struct {
+	datastore Datastore
+	get       Handler
+	save      Handler
+	delete    Handler
+}
+
+// InterceptDatastore returns a Datastore that runs every call through the interceptors before it
+// reaches datastore. The returned datastore is a Deleter, failing with ErrUnsupported if datastore is not.
+func InterceptDatastore(datastore Datastore, interceptors ...Interceptor) Datastore {
+	ds := &interceptedDatastore{
+		datastore: datastore,
+	}
+
+	ds.get = chainHandler(interceptors, func(ctx context.Context, call *Call) error {
+		return ds.datastore.Get(ctx, call.Model)
+	})
+	ds.save = chainHandler(interceptors, func(ctx context.Context, call *Call) error {
+		return ds.datastore.Save(ctx, call.Model)
+	})
+	ds.delete = chainHandler(interceptors, func(ctx context.Context, call *Call) error {
+		return Delete(ctx, ds.datastore, call.Model)
+	})
+
+	return ds
+}
+
+func (ds *interceptedDatastore) Get(ctx context.Context, model *Model) error {
+	call := &Call{Type: model.Type, ID: model.ID, Operation: OperationDatastoreGet, Model: model}
+	err := ds.get(ctx, call)
+
+	// An interceptor may have swapped the model, for instance to answer from elsewhere; the caller
+	// still expects its own model to be populated.
+	if call.Model != nil && call.Model != model {
+		*model = *call.Model
+	}
+
+	return err
+}
+
+func (ds *interceptedDatastore) Save(ctx context.Context, model *Model) error {
+	return ds.save(ctx, &Call{Type: model.Type, ID: model.ID, Operation: OperationDatastoreSave, Model: model})
+}
+
+func (ds *interceptedDatastore) Delete(ctx context.Context, model *Model) error {
+	return ds.delete(ctx, &Call{Type: model.Type, ID: model.ID, Operation: OperationDatastoreDelete, Model: model})
+}
+
+// Close closes the wrapped datastore. Closing is not intercepted.
+func (ds *interceptedDatastore) Close(ctx context.Context) error {
+	return CloseAll(ctx, ds.datastore)
+}
+
+// ScanIDs scans the IDs stored in the wrapped datastore. Scans are not intercepted.
+func (ds *interceptedDatastore) ScanIDs(ctx context.Context, itemType Type, fn func(id string) error) error {
+	return ScanIDs(ctx, ds.datastore, itemType, fn)
+}
+
+// List lists the models stored in the wrapped datastore. Listing is not intercepted.
+func (ds *interceptedDatastore) List(ctx context.Context, itemType Type, filter ListFilter, pageToken string) (*Page, error) {
+	return List(ctx, ds.datastore, itemType, filter, pageToken)
+}
+
+// ChangedSince lists the models changed in the wrapped datastore. Listing is not intercepted.
+func (ds *interceptedDatastore) ChangedSince(ctx context.Context, itemType Type, since time.Time, cursor string) (*Changes, error) {
+	return ChangedSince(ctx, ds.datastore, itemType, since, cursor)
+}
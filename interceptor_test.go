@@ -0,0 +1,107 @@
+package propagatedstorage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func recordingInterceptor(name string, calls *[]string) propagatedstorage.Interceptor {
+	return func(ctx context.Context, call *propagatedstorage.Call, next propagatedstorage.Handler) error {
+		*calls = append(*calls, name+">"+string(call.Operation)+":"+call.ID)
+		err := next(ctx, call)
+		*calls = append(*calls, name+"<")
+		return err
+	}
+}
+
+func TestChain_Order(t *testing.T) {
+	// Setup
+	var (
+		testId = "ThisIsMyID"
+		ctx    = context.TODO()
+		calls  []string
+	)
+
+	// Mock
+	var (
+		inputItem       = &TestItem{ID: testId}
+		fallbackService = &TestService{}
+	)
+
+	// Expect
+	fallbackService.On("Save", mock.Anything, inputItem).Return(nil)
+
+	// Apply
+	chain := propagatedstorage.Chain(recordingInterceptor("a", &calls), recordingInterceptor("b", &calls))
+	service := propagatedstorage.InterceptService(fallbackService, TestType, chain, recordingInterceptor("c", &calls))
+	err := service.Save(ctx, inputItem)
+
+	// Assert
+	fallbackService.AssertExpectations(t)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a>Service.Save:ThisIsMyID", "b>Service.Save:ThisIsMyID", "c>Service.Save:ThisIsMyID", "c<", "b<", "a<"}, calls)
+}
+
+func TestInterceptService_ShortCircuit(t *testing.T) {
+	// Setup
+	var (
+		ctx      = context.TODO()
+		denied   = errors.New("denied")
+		fallback = &TestService{}
+	)
+
+	// Apply
+	service := propagatedstorage.InterceptService(fallback, TestType, func(ctx context.Context, call *propagatedstorage.Call, next propagatedstorage.Handler) error {
+		if call.Type == TestType {
+			return denied
+		}
+		return next(ctx, call)
+	})
+	err := service.Get(ctx, &TestItem{ID: "ThisIsMyID"})
+
+	// Assert
+	fallback.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+	assert.Equal(t, denied, err)
+}
+
+func TestInterceptDatastore_ModifyModel(t *testing.T) {
+	// Setup
+	var (
+		testId   = "ThisIsMyID"
+		testType = TestType
+		ctx      = context.TODO()
+	)
+
+	// Mock
+	var (
+		inputItem    = &TestItem{ID: testId}
+		responseItem = &TestItem{ID: testId, Version: 3}
+		datastore    = &TestDatastore{}
+	)
+
+	// Expect
+	datastore.On("Get", mock.Anything, MockModel(inputItem, "RewrittenType")).Return(nil, MockModelWithItem(responseItem, testType))
+
+	// Apply
+	intercepted := propagatedstorage.InterceptDatastore(datastore, func(ctx context.Context, call *propagatedstorage.Call, next propagatedstorage.Handler) error {
+		rewritten := *call.Model
+		rewritten.Type = "RewrittenType"
+		call.Model = &rewritten
+		return next(ctx, call)
+	})
+	model := MockModel(inputItem, testType)
+	err := intercepted.Get(ctx, model)
+
+	// Assert
+	datastore.AssertExpectations(t)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, model.Version)
+	assert.Equal(t, responseItem, model.Item)
+}
@@ -0,0 +1,138 @@
+// Package invalidation keeps the caches of several instances coherent by broadcasting the changes made
+// through one instance over a gocloud.dev pub/sub topic. Every instance wraps its datastore in a
+// Broadcaster and listens on its own subscription to the topic, evicting or refreshing the models that
+// were changed elsewhere.
+package invalidation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	"gocloud.dev/pubsub"
+)
+
+// Message is the body of a published invalidation, encoded as JSON.
+type Message struct {
+	Type    propagatedstorage.Type `json:"type"`
+	ID      string                 `json:"id"`
+	Version int                    `json:"version"`
+	// Deleted is true if the model was deleted rather than saved.
+	Deleted bool `json:"deleted,omitempty"`
+	// Origin identifies the instance that made the change.
+	Origin string `json:"origin"`
+}
+
+// Invalidator is implemented by caches that can drop, or refresh, a single model. *cache.Datastore is an
+// Invalidator.
+type Invalidator interface {
+	Invalidate(ctx context.Context, itemType propagatedstorage.Type, id string) error
+}
+
+// Broadcaster is a datastore that publishes a Message to a topic after every successful Save and Delete
+// of the datastore it wraps.
+type Broadcaster struct {
+	datastore propagatedstorage.Datastore
+	topic     *pubsub.Topic
+	origin    string
+}
+
+// NewBroadcaster wraps datastore in a Broadcaster publishing to topic. origin identifies this instance,
+// so Listen can skip the changes it made itself.
+func NewBroadcaster(datastore propagatedstorage.Datastore, topic *pubsub.Topic, origin string) *Broadcaster {
+	return &Broadcaster{
+		datastore: datastore,
+		topic:     topic,
+		origin:    origin,
+	}
+}
+
+// Get gets model from the wrapped datastore.
+func (b *Broadcaster) Get(ctx context.Context, model *propagatedstorage.Model) error {
+	return b.datastore.Get(ctx, model)
+}
+
+// Save saves model to the wrapped datastore and publishes the change. The model is saved even if
+// publishing fails, in which case the publish error is returned.
+func (b *Broadcaster) Save(ctx context.Context, model *propagatedstorage.Model) error {
+	if err := b.datastore.Save(ctx, model); err != nil {
+		return err
+	}
+	return b.publish(ctx, model, false)
+}
+
+// Delete deletes model from the wrapped datastore and publishes the change. The model is deleted even
+// if publishing fails, in which case the publish error is returned.
+func (b *Broadcaster) Delete(ctx context.Context, model *propagatedstorage.Model) error {
+	if err := propagatedstorage.Delete(ctx, b.datastore, model); err != nil {
+		return err
+	}
+	return b.publish(ctx, model, true)
+}
+
+// Close closes the wrapped datastore. The topic is left open, as it was opened by the caller.
+func (b *Broadcaster) Close(ctx context.Context) error {
+	return propagatedstorage.CloseAll(ctx, b.datastore)
+}
+
+// ScanIDs scans the IDs stored in the wrapped datastore.
+func (b *Broadcaster) ScanIDs(ctx context.Context, itemType propagatedstorage.Type, fn func(id string) error) error {
+	return propagatedstorage.ScanIDs(ctx, b.datastore, itemType, fn)
+}
+
+// List lists the models stored in the wrapped datastore.
+func (b *Broadcaster) List(ctx context.Context, itemType propagatedstorage.Type, filter propagatedstorage.ListFilter, pageToken string) (*propagatedstorage.Page, error) {
+	return propagatedstorage.List(ctx, b.datastore, itemType, filter, pageToken)
+}
+
+// ChangedSince lists the models changed in the wrapped datastore.
+func (b *Broadcaster) ChangedSince(ctx context.Context, itemType propagatedstorage.Type, since time.Time, cursor string) (*propagatedstorage.Changes, error) {
+	return propagatedstorage.ChangedSince(ctx, b.datastore, itemType, since, cursor)
+}
+
+func (b *Broadcaster) publish(ctx context.Context, model *propagatedstorage.Model, deleted bool) error {
+	body, err := json.Marshal(Message{
+		Type:    model.Type,
+		ID:      model.ID,
+		Version: model.Version,
+		Deleted: deleted,
+		Origin:  b.origin,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := b.topic.Send(ctx, &pubsub.Message{Body: body}); err != nil {
+		return fmt.Errorf("could not publish invalidation of %s %s: %w", model.Type, model.ID, err)
+	}
+	return nil
+}
+
+// Listen receives invalidations from sub and passes them on to invalidator until ctx is done, skipping
+// those published by origin. Messages are acknowledged once invalidated and left to be redelivered if
+// invalidation fails. Listen returns nil when ctx is done and the receive error otherwise.
+func Listen(ctx context.Context, sub *pubsub.Subscription, invalidator Invalidator, origin string) error {
+	for {
+		msg, err := sub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		var m Message
+		if err := json.Unmarshal(msg.Body, &m); err != nil {
+			// A malformed message will never invalidate anything, so there is no point redelivering it.
+			msg.Ack()
+			continue
+		}
+
+		if m.Origin != origin && invalidator.Invalidate(ctx, m.Type, m.ID) != nil {
+			continue
+		}
+		msg.Ack()
+	}
+}
@@ -0,0 +1,196 @@
+package invalidation_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/cache"
+	"github.com/Tanax/propagatedstorage/datastoretest"
+	"github.com/Tanax/propagatedstorage/invalidation"
+	"github.com/Tanax/propagatedstorage/memstore"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
+	"gocloud.dev/pubsub/mempubsub"
+)
+
+const testType propagatedstorage.Type = "TestType"
+
+type instance struct {
+	cache     *cache.Datastore
+	datastore propagatedstorage.Datastore
+}
+
+// newInstances returns two instances caching the same backing datastore, each listening to the
+// invalidations of the other until the test ends. Each instance publishes to the topic of the other,
+// as mempubsub races when a topic has more than one subscription.
+func newInstances(t *testing.T, opts ...cache.Option) (*instance, *instance) {
+	var (
+		backing     = memstore.New()
+		ctx, cancel = context.WithCancel(context.Background())
+		done        = make(chan struct{}, 2)
+		topics      []*pubsub.Topic
+	)
+
+	newInstance := func(origin string) (*instance, *pubsub.Topic) {
+		c := cache.New(backing, opts...)
+		topic := mempubsub.NewTopic()
+		sub := mempubsub.NewSubscription(topic, time.Second)
+		topics = append(topics, topic)
+		go func() {
+			assert.Nil(t, invalidation.Listen(ctx, sub, c, origin))
+			done <- struct{}{}
+		}()
+		return &instance{cache: c}, topic
+	}
+	a, topicA := newInstance("a")
+	b, topicB := newInstance("b")
+	a.datastore = invalidation.NewBroadcaster(a.cache, topicB, "a")
+	b.datastore = invalidation.NewBroadcaster(b.cache, topicA, "b")
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		<-done
+		for _, topic := range topics {
+			topic.Shutdown(context.Background())
+		}
+	})
+	return a, b
+}
+
+func save(t *testing.T, ds propagatedstorage.Datastore, id string, version int) {
+	model := propagatedstorage.NewModel(id, testType, version)
+	model.Item = propagatedstoragetest.NewItem(testType, id, version, "payload")
+	require.Nil(t, ds.Save(context.TODO(), model))
+}
+
+func version(ds propagatedstorage.Datastore, id string) int {
+	model := propagatedstorage.NewModel(id, testType, 0)
+	if err := ds.Get(context.TODO(), model); err != nil {
+		return -1
+	}
+	return model.Version
+}
+
+func TestConformance(t *testing.T) {
+	datastoretest.RunConformanceTests(t, func(t *testing.T) propagatedstorage.Datastore {
+		return invalidation.NewBroadcaster(memstore.New(), mempubsub.NewTopic(), "test")
+	})
+}
+
+func TestSave_EvictsOtherInstances(t *testing.T) {
+	// Setup
+	a, b := newInstances(t)
+	save(t, a.datastore, "ThisIsMyID", 1)
+	require.Equal(t, 1, version(b.datastore, "ThisIsMyID"))
+
+	// Apply
+	save(t, a.datastore, "ThisIsMyID", 2)
+
+	// Assert
+	propagatedstoragetest.Eventually(t, func() bool { return version(b.datastore, "ThisIsMyID") == 2 })
+}
+
+func TestSave_RefreshesOtherInstances(t *testing.T) {
+	// Setup
+	a, b := newInstances(t, cache.WithRefreshOnInvalidate())
+	save(t, a.datastore, "ThisIsMyID", 1)
+	require.Equal(t, 1, version(b.datastore, "ThisIsMyID"))
+
+	// Apply
+	save(t, a.datastore, "ThisIsMyID", 2)
+
+	// Assert
+	propagatedstoragetest.Eventually(t, func() bool { return version(b.datastore, "ThisIsMyID") == 2 })
+}
+
+func TestDelete_EvictsOtherInstances(t *testing.T) {
+	// Setup
+	a, b := newInstances(t)
+	save(t, a.datastore, "ThisIsMyID", 1)
+	require.Equal(t, 1, version(b.datastore, "ThisIsMyID"))
+
+	// Apply
+	err := propagatedstorage.Delete(context.TODO(), a.datastore, propagatedstorage.NewModel("ThisIsMyID", testType, 0))
+
+	// Assert
+	require.Nil(t, err)
+	propagatedstoragetest.Eventually(t, func() bool { return version(b.datastore, "ThisIsMyID") == -1 })
+}
+
+func TestSave_PublishFailure(t *testing.T) {
+	// Setup
+	topic := mempubsub.NewTopic()
+	require.Nil(t, topic.Shutdown(context.Background()))
+	backing := memstore.New()
+	ds := invalidation.NewBroadcaster(backing, topic, "test")
+
+	// Apply
+	model := propagatedstorage.NewModel("ThisIsMyID", testType, 1)
+	err := ds.Save(context.TODO(), model)
+
+	// Assert
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, version(backing, "ThisIsMyID"), "the model is saved even if publishing fails")
+}
+
+func TestListen_SkipsOwnOrigin(t *testing.T) {
+	// Setup
+	var (
+		topic       = mempubsub.NewTopic()
+		sub         = mempubsub.NewSubscription(topic, time.Second)
+		invalidated = make(chan string, 2)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+	go invalidation.Listen(ctx, sub, invalidatorFunc(func(ctx context.Context, itemType propagatedstorage.Type, id string) error {
+		invalidated <- id
+		return nil
+	}), "self")
+
+	// Apply
+	send(t, topic, invalidation.Message{Type: testType, ID: "mine", Origin: "self"})
+	send(t, topic, invalidation.Message{Type: testType, ID: "theirs", Origin: "other"})
+
+	// Assert
+	select {
+	case id := <-invalidated:
+		assert.Equal(t, "theirs", id)
+	case <-time.After(time.Second):
+		t.Fatal("no invalidation received")
+	}
+}
+
+func TestListen_ReturnsNilWhenDone(t *testing.T) {
+	// Setup
+	topic := mempubsub.NewTopic()
+	sub := mempubsub.NewSubscription(topic, time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Apply
+	err := invalidation.Listen(ctx, sub, invalidatorFunc(func(context.Context, propagatedstorage.Type, string) error {
+		return errors.New("must not be called")
+	}), "self")
+
+	// Assert
+	assert.Nil(t, err)
+}
+
+type invalidatorFunc func(ctx context.Context, itemType propagatedstorage.Type, id string) error
+
+func (f invalidatorFunc) Invalidate(ctx context.Context, itemType propagatedstorage.Type, id string) error {
+	return f(ctx, itemType, id)
+}
+
+func send(t *testing.T, topic *pubsub.Topic, m invalidation.Message) {
+	body, err := json.Marshal(m)
+	require.Nil(t, err)
+	require.Nil(t, topic.Send(context.Background(), &pubsub.Message{Body: body}))
+}
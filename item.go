@@ -1,8 +1,51 @@
 package propagatedstorage
 
+import (
+	"fmt"
+	"time"
+)
+
 // Item describes how a propagated data item should look
 type Item interface {
 	GetCurrentVersion() int
 	GetID() string
 	PopulateFromItem(item Item) error
 }
+
+// TypedItem is an Item that declares its own Type, which lets a Router dispatch it.
+type TypedItem interface {
+	Item
+	GetType() Type
+}
+
+// ExpiringItem is an Item that sets its own expiry, overriding the one of its service. A zero expiry
+// means the item never expires.
+type ExpiringItem interface {
+	Item
+	GetExpires() time.Time
+}
+
+// Cloner is implemented by items that can copy themselves. Datastores and caches that keep items in
+// memory store and hand out copies of them, so callers cannot change what is stored by mutating their
+// items.
+type Cloner interface {
+	Clone() Item
+}
+
+// CloneItem returns a copy of item, made by its Clone method if it is a Cloner and by encoding and
+// decoding it with codec otherwise, in which case its Type must be registered on codec. A nil item is
+// returned as is.
+func CloneItem(codec Codec, itemType Type, item Item) (Item, error) {
+	if item == nil {
+		return nil, nil
+	}
+	if cloner, ok := item.(Cloner); ok {
+		return cloner.Clone(), nil
+	}
+
+	data, err := codec.Marshal(item)
+	if err != nil {
+		return nil, fmt.Errorf("could not copy item of type %s: %w", itemType, err)
+	}
+	return codec.Unmarshal(itemType, data)
+}
@@ -0,0 +1,76 @@
+package propagatedstorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultPageSize is the number of models a page of List holds unless the filter says otherwise.
+const DefaultPageSize = 100
+
+// ListFilter restricts the models List returns. Its zero value lists every model of a Type.
+type ListFilter struct {
+	// MinVersion and MaxVersion bound the Version of the models, both inclusive. MaxVersion is no
+	// bound if it is zero.
+	MinVersion int
+	MaxVersion int
+	// ModifiedSince and ModifiedBefore bound the Modified time of the models, from ModifiedSince on up
+	// to but excluding ModifiedBefore. Zero times are no bounds.
+	ModifiedSince  time.Time
+	ModifiedBefore time.Time
+	// PageSize is the maximum number of models of a page. Defaults to DefaultPageSize.
+	PageSize int
+}
+
+// Match reports whether model passes the filter, for Listers that filter models themselves.
+func (f ListFilter) Match(model *Model) bool {
+	switch {
+	case model.Version < f.MinVersion:
+		return false
+	case f.MaxVersion > 0 && model.Version > f.MaxVersion:
+		return false
+	case !f.ModifiedSince.IsZero() && model.Modified.Before(f.ModifiedSince):
+		return false
+	case !f.ModifiedBefore.IsZero() && !model.Modified.Before(f.ModifiedBefore):
+		return false
+	}
+	return true
+}
+
+// Limit returns the page size of the filter.
+func (f ListFilter) Limit() int {
+	if f.PageSize > 0 {
+		return f.PageSize
+	}
+	return DefaultPageSize
+}
+
+// Page is a page of listed models.
+type Page struct {
+	Models []*Model
+	// NextPageToken resumes listing after the models of the page. It is empty on the last page.
+	NextPageToken string
+}
+
+// Lister is implemented by datastores that can list the models they store.
+type Lister interface {
+	// List returns the page of the models of itemType passing filter that starts at pageToken, or at
+	// the first model if pageToken is empty. Models are listed in ID order and expired models are
+	// left out, without counting toward the page size, so only the last page may hold fewer models.
+	// Page tokens are only valid for the datastore that returned them, with the same filter; others
+	// fail with ErrInvalidPageToken.
+	List(ctx context.Context, itemType Type, filter ListFilter, pageToken string) (*Page, error)
+}
+
+// List lists a page of the models of itemType stored in datastore. It fails with ErrUnsupported if
+// datastore is not a Lister.
+func List(ctx context.Context, datastore Datastore, itemType Type, filter ListFilter, pageToken string) (*Page, error) {
+	lister, ok := datastore.(Lister)
+	if !ok {
+		e := ErrUnsupported.Wrap(fmt.Errorf("%T cannot list", datastore))
+		e.Type = itemType
+		return nil, e
+	}
+	return lister.List(ctx, itemType, filter, pageToken)
+}
@@ -0,0 +1,276 @@
+// Package memstore provides an in-memory propagated storage datastore, meant for tests and local
+// development. It follows the semantics of the DynamoDB datastore: models are keyed by Type and ID,
+// and reading a model that was never saved, or that has expired, fails with
+// propagatedstorage.ErrNotFound.
+package memstore
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+)
+
+// Cloner is implemented by items that can copy themselves.
+//
+// Deprecated: use propagatedstorage.Cloner.
+type Cloner = propagatedstorage.Cloner
+
+type key struct {
+	itemType propagatedstorage.Type
+	id       string
+}
+
+// Datastore is an in-memory propagated storage datastore. It stores and hands out copies of items, so
+// neither the saver nor a reader can change what is stored by mutating their item. Items are copied as
+// propagatedstorage.CloneItem does, so the Types of items that are not propagatedstorage.Cloners must
+// be registered on the codec of the datastore. It is safe for concurrent use.
+type Datastore struct {
+	now   func() time.Time
+	codec propagatedstorage.Codec
+
+	mu     sync.RWMutex
+	models map[key]propagatedstorage.Model
+}
+
+// Option configures optional behaviour of an in-memory datastore.
+type Option func(ds *Datastore)
+
+// WithClock sets the clock used to expire models. Defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(ds *Datastore) {
+		ds.now = now
+	}
+}
+
+// WithCodec sets the codec copying items that are not propagatedstorage.Cloners. Defaults to
+// propagatedstorage.DefaultCodec.
+func WithCodec(codec propagatedstorage.Codec) Option {
+	return func(ds *Datastore) {
+		ds.codec = codec
+	}
+}
+
+// New returns a new, empty in-memory datastore.
+func New(opts ...Option) *Datastore {
+	ds := &Datastore{
+		now:    time.Now,
+		codec:  propagatedstorage.DefaultCodec,
+		models: make(map[key]propagatedstorage.Model),
+	}
+
+	for _, opt := range opts {
+		opt(ds)
+	}
+
+	return ds
+}
+
+// Get populates model with the stored model of the same Type and ID. Expired models are removed
+// when they are read.
+func (ds *Datastore) Get(ctx context.Context, model *propagatedstorage.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	k := key{model.Type, model.ID}
+	ds.mu.RLock()
+	stored, ok := ds.models[k]
+	ds.mu.RUnlock()
+
+	if ok && stored.Expired(ds.now()) {
+		ds.mu.Lock()
+		if current, ok := ds.models[k]; ok && current.Expired(ds.now()) {
+			delete(ds.models, k)
+		}
+		ds.mu.Unlock()
+		ok = false
+	}
+
+	if !ok {
+		e := propagatedstorage.ErrNotFound.Wrap(nil)
+		e.Type = model.Type
+		e.ID = model.ID
+		return e
+	}
+
+	item, err := propagatedstorage.CloneItem(ds.codec, stored.Type, stored.Item)
+	if err != nil {
+		return err
+	}
+	*model = stored
+	model.Item = item
+
+	return nil
+}
+
+// Save stores a copy of model, replacing any model of the same Type and ID. It fails if the item of
+// model cannot be copied.
+func (ds *Datastore) Save(ctx context.Context, model *propagatedstorage.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	item, err := propagatedstorage.CloneItem(ds.codec, model.Type, model.Item)
+	if err != nil {
+		return err
+	}
+	stored := *model
+	stored.Item = item
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.models[key{model.Type, model.ID}] = stored
+	return nil
+}
+
+// Delete removes the stored model of the same Type and ID as model.
+func (ds *Datastore) Delete(ctx context.Context, model *propagatedstorage.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	delete(ds.models, key{model.Type, model.ID})
+	return nil
+}
+
+// ScanIDs calls fn with the ID of every stored model of itemType that has not expired. Models saved
+// or deleted while scanning may or may not be seen.
+func (ds *Datastore) ScanIDs(ctx context.Context, itemType propagatedstorage.Type, fn func(id string) error) error {
+	now := ds.now()
+
+	ds.mu.RLock()
+	var ids []string
+	for k, model := range ds.models {
+		if k.itemType == itemType && !model.Expired(now) {
+			ids = append(ids, k.id)
+		}
+	}
+	ds.mu.RUnlock()
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns a page of the models of itemType passing filter, in ID order. Page tokens hold the
+// last ID of the previous page, so models saved or deleted between pages are seen if they come after
+// it.
+func (ds *Datastore) List(ctx context.Context, itemType propagatedstorage.Type, filter propagatedstorage.ListFilter, pageToken string) (*propagatedstorage.Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	after, err := base64.RawURLEncoding.DecodeString(pageToken)
+	if err != nil {
+		e := propagatedstorage.ErrInvalidPageToken.Wrap(err)
+		e.Type = itemType
+		return nil, e
+	}
+
+	now := ds.now()
+	var models []*propagatedstorage.Model
+
+	ds.mu.RLock()
+	for k, stored := range ds.models {
+		if k.itemType != itemType || (pageToken != "" && k.id <= string(after)) || stored.Expired(now) || !filter.Match(&stored) {
+			continue
+		}
+		model := stored
+		models = append(models, &model)
+	}
+	ds.mu.RUnlock()
+
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+
+	page := &propagatedstorage.Page{Models: models}
+	if limit := filter.Limit(); len(models) > limit {
+		page.Models = models[:limit]
+		page.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(models[limit-1].ID))
+	}
+	if err := ds.cloneItems(page.Models); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// ChangedSince returns a batch of the models of itemType modified after the watermark of since or
+// cursor, in Modified and then ID order.
+func (ds *Datastore) ChangedSince(ctx context.Context, itemType propagatedstorage.Type, since time.Time, cursor string) (*propagatedstorage.Changes, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	watermark, err := propagatedstorage.StartWatermark(itemType, since, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	now := ds.now()
+	var models []*propagatedstorage.Model
+
+	ds.mu.RLock()
+	for k, stored := range ds.models {
+		if k.itemType != itemType || stored.Expired(now) || !watermark.Before(&stored) {
+			continue
+		}
+		model := stored
+		models = append(models, &model)
+	}
+	ds.mu.RUnlock()
+
+	sort.Slice(models, func(i, j int) bool {
+		if !models[i].Modified.Equal(models[j].Modified) {
+			return models[i].Modified.Before(models[j].Modified)
+		}
+		return models[i].ID < models[j].ID
+	})
+
+	changes := &propagatedstorage.Changes{Models: models}
+	if len(models) > propagatedstorage.DefaultPageSize {
+		changes.Models = models[:propagatedstorage.DefaultPageSize]
+		changes.More = true
+	}
+	if err := ds.cloneItems(changes.Models); err != nil {
+		return nil, err
+	}
+	if n := len(changes.Models); n > 0 {
+		watermark = propagatedstorage.Watermark{Modified: changes.Models[n-1].Modified, ID: changes.Models[n-1].ID}
+	}
+	changes.Cursor = watermark.Cursor()
+
+	return changes, nil
+}
+
+// Len returns the number of stored models.
+func (ds *Datastore) Len() int {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	return len(ds.models)
+}
+
+// cloneItems replaces the stored items of models by copies.
+func (ds *Datastore) cloneItems(models []*propagatedstorage.Model) error {
+	for _, model := range models {
+		item, err := propagatedstorage.CloneItem(ds.codec, model.Type, model.Item)
+		if err != nil {
+			return err
+		}
+		model.Item = item
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package memstore_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/datastoretest"
+	"github.com/Tanax/propagatedstorage/memstore"
+	"github.com/stretchr/testify/assert"
+)
+
+type testItem struct {
+	ID      string
+	Version int
+	Name    string
+}
+
+func (ti *testItem) GetCurrentVersion() int {
+	return ti.Version
+}
+
+func (ti *testItem) GetID() string {
+	return ti.ID
+}
+
+func (ti *testItem) PopulateFromItem(item propagatedstorage.Item) error {
+	other, ok := item.(*testItem)
+	if !ok {
+		return fmt.Errorf("unexpected item %T", item)
+	}
+	*ti = *other
+	return nil
+}
+
+func (ti *testItem) Clone() propagatedstorage.Item {
+	c := *ti
+	return &c
+}
+
+type testService struct {
+	name string
+}
+
+func (ts *testService) Get(ctx context.Context, item propagatedstorage.Item) error {
+	item.(*testItem).Name = ts.name
+	item.(*testItem).Version = 2
+	return nil
+}
+
+func (ts *testService) Save(ctx context.Context, item propagatedstorage.Item) error {
+	return nil
+}
+
+func TestGet_NotFound(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		datastore = memstore.New()
+		model     = propagatedstorage.NewModel("ThisIsMyID", "MyType", 0)
+	)
+
+	// Apply
+	err := datastore.Get(ctx, model)
+
+	// Assert
+	assert.True(t, errors.Is(err, propagatedstorage.ErrNotFound))
+}
+
+func TestGet_Expired(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		now       = time.Now()
+		datastore = memstore.New(memstore.WithClock(func() time.Time { return now }))
+		model     = propagatedstorage.NewModel("ThisIsMyID", "MyType", 1)
+	)
+	model.Expires = now.Add(time.Minute)
+	assert.Nil(t, datastore.Save(ctx, model))
+
+	// Apply
+	freshErr := datastore.Get(ctx, propagatedstorage.NewModel("ThisIsMyID", "MyType", 0))
+	now = now.Add(time.Minute)
+	expiredErr := datastore.Get(ctx, propagatedstorage.NewModel("ThisIsMyID", "MyType", 0))
+
+	// Assert
+	assert.Nil(t, freshErr)
+	assert.True(t, errors.Is(expiredErr, propagatedstorage.ErrNotFound))
+	assert.Equal(t, 0, datastore.Len(), "expired models must be removed")
+}
+
+func TestSave_KeyedByTypeAndID(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		datastore = memstore.New()
+		now       = time.Now()
+	)
+
+	// Apply
+	saved := propagatedstorage.NewModel("ThisIsMyID", "MyType", 3)
+	saved.Item = &testItem{ID: "ThisIsMyID", Version: 3, Name: "Heyhey"}
+	saved.Created = now
+	saved.Modified = now
+	assert.Nil(t, datastore.Save(ctx, saved))
+
+	model := propagatedstorage.NewModel("ThisIsMyID", "MyType", 0)
+	err := datastore.Get(ctx, model)
+	otherTypeErr := datastore.Get(ctx, propagatedstorage.NewModel("ThisIsMyID", "OtherType", 0))
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, saved, model)
+	assert.True(t, errors.Is(otherTypeErr, propagatedstorage.ErrNotFound))
+}
+
+func TestGet_CopyOnRead(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		datastore = memstore.New()
+		item      = &testItem{ID: "ThisIsMyID", Version: 1, Name: "Heyhey"}
+	)
+
+	// Apply
+	saved := propagatedstorage.NewModel(item.ID, "MyType", item.Version)
+	saved.Item = item
+	assert.Nil(t, datastore.Save(ctx, saved))
+	item.Name = "changed after save"
+
+	first := propagatedstorage.NewModel(item.ID, "MyType", 0)
+	assert.Nil(t, datastore.Get(ctx, first))
+	first.Item.(*testItem).Name = "changed after read"
+
+	second := propagatedstorage.NewModel(item.ID, "MyType", 0)
+	assert.Nil(t, datastore.Get(ctx, second))
+
+	// Assert
+	assert.Equal(t, "Heyhey", second.Item.(*testItem).Name)
+}
+
+// plainItem is a testItem that cannot copy itself.
+type plainItem struct {
+	ID      string
+	Version int
+	Name    string
+}
+
+func (pi *plainItem) GetCurrentVersion() int {
+	return pi.Version
+}
+
+func (pi *plainItem) GetID() string {
+	return pi.ID
+}
+
+func (pi *plainItem) PopulateFromItem(item propagatedstorage.Item) error {
+	return nil
+}
+
+func TestGet_CopyOnReadWithCodec(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		codec     = propagatedstorage.NewJSONCodec()
+		datastore = memstore.New(memstore.WithCodec(codec))
+		item      = &plainItem{ID: "ThisIsMyID", Version: 1, Name: "Heyhey"}
+	)
+	codec.Register("MyType", func() propagatedstorage.Item { return new(plainItem) })
+
+	// Apply
+	saved := propagatedstorage.NewModel(item.ID, "MyType", item.Version)
+	saved.Item = item
+	assert.Nil(t, datastore.Save(ctx, saved))
+	item.Name = "changed after save"
+
+	first := propagatedstorage.NewModel(item.ID, "MyType", 0)
+	assert.Nil(t, datastore.Get(ctx, first))
+	first.Item.(*plainItem).Name = "changed after read"
+
+	second := propagatedstorage.NewModel(item.ID, "MyType", 0)
+	assert.Nil(t, datastore.Get(ctx, second))
+
+	// Assert
+	assert.Equal(t, "Heyhey", second.Item.(*plainItem).Name)
+}
+
+func TestSave_UncopyableItem(t *testing.T) {
+	// Setup
+	var (
+		datastore = memstore.New(memstore.WithCodec(propagatedstorage.NewJSONCodec()))
+		model     = propagatedstorage.NewModel("ThisIsMyID", "MyType", 1)
+	)
+	model.Item = &plainItem{ID: "ThisIsMyID", Version: 1}
+
+	// Apply
+	err := datastore.Save(context.TODO(), model)
+
+	// Assert
+	assert.True(t, errors.Is(err, propagatedstorage.ErrUnknownType))
+	assert.Equal(t, 0, datastore.Len())
+}
+
+func TestGet_CanceledContext(t *testing.T) {
+	// Setup
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	// Apply
+	err := memstore.New().Get(ctx, propagatedstorage.NewModel("ThisIsMyID", "MyType", 0))
+
+	// Assert
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestSave_Concurrent(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		datastore = memstore.New()
+		wg        sync.WaitGroup
+	)
+
+	// Apply
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			model := propagatedstorage.NewModel(fmt.Sprintf("ID%d", i%10), "MyType", i)
+			model.Item = &testItem{ID: model.ID, Version: i}
+			assert.Nil(t, datastore.Save(ctx, model))
+			assert.Nil(t, datastore.Get(ctx, propagatedstorage.NewModel(model.ID, "MyType", 0)))
+		}(i)
+	}
+	wg.Wait()
+
+	// Assert
+	assert.Equal(t, 10, datastore.Len())
+}
+
+func TestService_FallbackOnMiss(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		datastore = memstore.New()
+		service   = propagatedstorage.NewService(datastore, "MyType", 1, &testService{name: "from owner"})
+		item      = &testItem{ID: "ThisIsMyID"}
+	)
+
+	// Apply
+	err := service.Get(ctx, item)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, "from owner", item.Name)
+
+	stored := propagatedstorage.NewModel(item.ID, "MyType", 0)
+	assert.Nil(t, datastore.Get(ctx, stored))
+	assert.Equal(t, 2, stored.Version)
+	assert.Equal(t, "from owner", stored.Item.(*testItem).Name)
+}
+
+func TestConformance(t *testing.T) {
+	datastoretest.RunConformanceTests(t, func(t *testing.T) propagatedstorage.Datastore {
+		return memstore.New()
+	})
+}
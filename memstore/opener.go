@@ -0,0 +1,26 @@
+package memstore
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/Tanax/propagatedstorage"
+)
+
+// Scheme is the URL scheme memstore registers on propagatedstorage.DefaultURLMux.
+const Scheme = "mem"
+
+func init() {
+	propagatedstorage.DefaultURLMux().RegisterDatastore(Scheme, &URLOpener{})
+}
+
+// URLOpener opens a new, empty in-memory datastore for every "mem://" URL.
+type URLOpener struct{}
+
+// OpenDatastoreURL opens a new in-memory datastore. The URL takes no parameters.
+func (o *URLOpener) OpenDatastoreURL(ctx context.Context, u *url.URL) (propagatedstorage.Datastore, error) {
+	if err := propagatedstorage.CheckURLParams(u); err != nil {
+		return nil, err
+	}
+	return New(), nil
+}
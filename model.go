@@ -13,6 +13,9 @@ type Model struct {
 
 	Created  time.Time
 	Modified time.Time
+	// Expires is when the model expires, after which it is treated as if it was not stored. The
+	// model never expires if it is zero.
+	Expires time.Time
 }
 
 // NewModel creates a new propagated data model
@@ -24,3 +27,8 @@ func NewModel(id string, itemType Type, version int) *Model {
 
 	return model
 }
+
+// Expired reports whether the model has expired at now.
+func (m *Model) Expired(now time.Time) bool {
+	return !m.Expires.IsZero() && !now.Before(m.Expires)
+}
@@ -1,6 +1,17 @@
 package propagatedstorage_test
 
-import "github.com/Tanax/propagatedstorage"
+import (
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+)
+
+// MockNow is the time of the clock of services saving mocked models.
+var MockNow = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func MockClock() time.Time {
+	return MockNow
+}
 
 func MockModelWithItem(item *TestItem, itemType propagatedstorage.Type) *propagatedstorage.Model {
 	model := MockModel(item, itemType)
@@ -8,6 +19,13 @@ func MockModelWithItem(item *TestItem, itemType propagatedstorage.Type) *propaga
 	return model
 }
 
+// MockSavedModel is the model a service with MockClock saves item as.
+func MockSavedModel(item *TestItem, itemType propagatedstorage.Type) *propagatedstorage.Model {
+	model := MockModelWithItem(item, itemType)
+	model.Modified = MockNow
+	return model
+}
+
 func MockModel(item *TestItem, itemType propagatedstorage.Type) *propagatedstorage.Model {
 	return propagatedstorage.NewModel(item.ID, itemType, item.Version)
 }
@@ -0,0 +1,74 @@
+package propagatedstorage
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultNegativeCacheSize is the number of IDs a negative cache remembers at most.
+const DefaultNegativeCacheSize = 10000
+
+// negativeCache remembers, for a while, the IDs the fallback service reported as not found.
+type negativeCache struct {
+	ttl     time.Duration
+	persist bool
+
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+func newNegativeCache(ttl time.Duration) *negativeCache {
+	return &negativeCache{
+		ttl:     ttl,
+		expires: make(map[string]time.Time),
+	}
+}
+
+// known reports whether id is remembered as not found at now.
+func (c *negativeCache) known(id string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires, ok := c.expires[id]
+	if !ok {
+		return false
+	}
+	if !now.Before(expires) {
+		delete(c.expires, id)
+		return false
+	}
+	return true
+}
+
+// remember remembers id as not found until expires. When the cache is full, expired IDs are dropped to
+// make room, and id is not remembered if that does not free any.
+func (c *negativeCache) remember(id string, expires time.Time, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.expires[id]; !ok && len(c.expires) >= DefaultNegativeCacheSize {
+		for id, expires := range c.expires {
+			if !now.Before(expires) {
+				delete(c.expires, id)
+			}
+		}
+		if len(c.expires) >= DefaultNegativeCacheSize {
+			return
+		}
+	}
+	c.expires[id] = expires
+}
+
+// forget forgets that id was not found.
+func (c *negativeCache) forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.expires, id)
+}
+
+// isTombstone reports whether model, as read from the datastore, is a tombstone: a model without an
+// item, saved to record that the fallback service did not know its ID.
+func isTombstone(model *Model) bool {
+	return model.Item == nil && !model.Modified.IsZero()
+}
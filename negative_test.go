@@ -0,0 +1,127 @@
+package propagatedstorage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/memstore"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func TestGet_NegativeCache(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		now       = &clock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		fallback  = propagatedstoragetest.NewFakeService()
+		datastore = memstore.New()
+		service   = propagatedstorage.NewService(datastore, TestType, 0, fallback, propagatedstorage.WithNegativeCache(time.Minute), propagatedstorage.WithClock(now.Now))
+	)
+
+	// Apply
+	first := service.Get(ctx, propagatedstoragetest.NewItem(TestType, "unknown", 0, ""))
+	second := service.Get(ctx, propagatedstoragetest.NewItem(TestType, "unknown", 0, ""))
+	now.now = now.now.Add(time.Minute)
+	expired := service.Get(ctx, propagatedstoragetest.NewItem(TestType, "unknown", 0, ""))
+
+	// Assert
+	assert.True(t, errors.Is(first, propagatedstorage.ErrNotFound))
+	assert.True(t, errors.Is(second, propagatedstorage.ErrNotFound))
+	assert.True(t, errors.Is(expired, propagatedstorage.ErrNotFound))
+
+	var e *propagatedstorage.Error
+	require.True(t, errors.As(second, &e))
+	assert.Equal(t, propagatedstorage.StageNegativeCache, e.Stage)
+
+	assert.Len(t, fallback.Calls(), 2, "the second Get must not reach the fallback service")
+	assert.Equal(t, 0, datastore.Len(), "a local negative cache must not write to the datastore")
+}
+
+func TestGet_NegativeCacheForgetOnSave(t *testing.T) {
+	// Setup
+	var (
+		ctx      = context.TODO()
+		fallback = propagatedstoragetest.NewFakeService()
+		service  = propagatedstorage.NewService(memstore.New(), TestType, 0, fallback, propagatedstorage.WithNegativeCache(time.Minute))
+	)
+	require.NotNil(t, service.Get(ctx, propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 0, "")))
+
+	// Apply
+	saveErr := service.Save(ctx, propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 1, "Heyhey"))
+	item := propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 0, "")
+	err := service.Get(ctx, item)
+
+	// Assert
+	assert.Nil(t, saveErr)
+	assert.Nil(t, err)
+	assert.Equal(t, "Heyhey", item.Payload)
+}
+
+func TestGet_PersistedNegativeCache(t *testing.T) {
+	// Setup
+	var (
+		ctx        = context.TODO()
+		now        = &clock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		fallback   = propagatedstoragetest.NewFakeService()
+		datastore  = memstore.New(memstore.WithClock(now.Now))
+		newService = func() propagatedstorage.Service {
+			return propagatedstorage.NewService(datastore, TestType, 0, fallback, propagatedstorage.WithPersistedNegativeCache(time.Minute), propagatedstorage.WithClock(now.Now))
+		}
+		first, second = newService(), newService()
+	)
+
+	// Apply
+	firstErr := first.Get(ctx, propagatedstoragetest.NewItem(TestType, "unknown", 0, ""))
+	secondErr := second.Get(ctx, propagatedstoragetest.NewItem(TestType, "unknown", 0, ""))
+
+	now.now = now.now.Add(time.Minute)
+	fallback.SetItem(propagatedstoragetest.NewItem(TestType, "unknown", 1, "Propagated at last"))
+	item := propagatedstoragetest.NewItem(TestType, "unknown", 0, "")
+	expiredErr := second.Get(ctx, item)
+
+	// Assert
+	assert.True(t, errors.Is(firstErr, propagatedstorage.ErrNotFound))
+	assert.True(t, errors.Is(secondErr, propagatedstorage.ErrNotFound), "the tombstone must be shared through the datastore")
+	assert.Len(t, fallback.Calls(), 2, "the second service must not reach the fallback service before the tombstone expires")
+
+	assert.Nil(t, expiredErr)
+	assert.Equal(t, "Propagated at last", item.Payload)
+
+	stored := propagatedstorage.NewModel("unknown", TestType, 0)
+	require.Nil(t, datastore.Get(ctx, stored))
+	assert.NotNil(t, stored.Item, "the tombstone must be overwritten by the propagated item")
+}
+
+func TestGet_PersistedTombstoneExpires(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		now       = &clock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		datastore = memstore.New(memstore.WithClock(now.Now))
+		service   = propagatedstorage.NewService(datastore, TestType, 0, propagatedstoragetest.NewFakeService(), propagatedstorage.WithPersistedNegativeCache(time.Minute), propagatedstorage.WithClock(now.Now))
+	)
+
+	// Apply
+	err := service.Get(ctx, propagatedstoragetest.NewItem(TestType, "unknown", 0, ""))
+	tombstone := propagatedstorage.NewModel("unknown", TestType, 0)
+	getErr := datastore.Get(ctx, tombstone)
+
+	// Assert
+	assert.True(t, errors.Is(err, propagatedstorage.ErrNotFound))
+	require.Nil(t, getErr)
+	assert.Nil(t, tombstone.Item)
+	assert.True(t, now.now.Add(time.Minute).Equal(tombstone.Expires), "the tombstone must expire with the negative cache")
+}
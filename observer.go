@@ -0,0 +1,50 @@
+package propagatedstorage
+
+import (
+	"context"
+	"time"
+)
+
+// Outcome describes how a stage of a storage operation ended.
+type Outcome string
+
+const (
+	// OutcomeHit means the datastore had the requested item.
+	OutcomeHit Outcome = "hit"
+	// OutcomeMiss means the datastore did not have the requested item.
+	OutcomeMiss Outcome = "miss"
+	// OutcomeOutdated means the stored item was below the required version.
+	OutcomeOutdated Outcome = "outdated"
+	// OutcomeExpired means the datastore had the requested item, but it had expired.
+	OutcomeExpired Outcome = "expired"
+	// OutcomeOK means the stage completed successfully.
+	OutcomeOK Outcome = "ok"
+	// OutcomeError means the stage failed.
+	OutcomeError Outcome = "error"
+)
+
+// Event describes a completed stage of a storage operation.
+type Event struct {
+	Type            Type
+	ID              string
+	Stage           Stage
+	Outcome         Outcome
+	RequiredVersion int
+	StoredVersion   int
+	Duration        time.Duration
+	Err             error
+}
+
+// Observer is notified by the service every time it completes a stage. Implementations must be
+// safe for concurrent use and should return quickly, as they are called inline.
+type Observer interface {
+	Observe(ctx context.Context, event Event)
+}
+
+// ObserverFunc adapts an ordinary function to the Observer interface.
+type ObserverFunc func(ctx context.Context, event Event)
+
+// Observe calls f(ctx, event).
+func (f ObserverFunc) Observe(ctx context.Context, event Event) {
+	f(ctx, event)
+}
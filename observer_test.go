@@ -0,0 +1,104 @@
+package propagatedstorage_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type TestObserver struct {
+	mu     sync.Mutex
+	events []propagatedstorage.Event
+}
+
+func (to *TestObserver) Observe(ctx context.Context, event propagatedstorage.Event) {
+	to.mu.Lock()
+	defer to.mu.Unlock()
+	to.events = append(to.events, event)
+}
+
+func (to *TestObserver) Outcomes() map[propagatedstorage.Stage]propagatedstorage.Outcome {
+	to.mu.Lock()
+	defer to.mu.Unlock()
+
+	outcomes := make(map[propagatedstorage.Stage]propagatedstorage.Outcome)
+	for _, event := range to.events {
+		outcomes[event.Stage] = event.Outcome
+	}
+	return outcomes
+}
+
+func TestObserver_Hit(t *testing.T) {
+	// Setup
+	var (
+		testId   = "ThisIsMyID"
+		testType = TestType
+		ctx      = context.TODO()
+	)
+
+	// Mock
+	var (
+		inputItem    = &TestItem{ID: testId}
+		responseItem = &TestItem{ID: testId, Version: 1}
+		datastore    = &TestDatastore{}
+		observer     = &TestObserver{}
+	)
+
+	// Expect
+	datastore.On("Get", mock.Anything, MockModel(inputItem, testType)).Return(nil, MockModelWithItem(responseItem, testType))
+	inputItem.On("PopulateFromItem", responseItem).Return(nil)
+
+	// Apply
+	service := propagatedstorage.NewService(datastore, testType, 1, nil, propagatedstorage.WithObserver(observer))
+	err := service.Get(ctx, inputItem)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, map[propagatedstorage.Stage]propagatedstorage.Outcome{
+		propagatedstorage.StageDatastoreGet: propagatedstorage.OutcomeHit,
+		propagatedstorage.StageVersionCheck: propagatedstorage.OutcomeOK,
+		propagatedstorage.StagePopulate:     propagatedstorage.OutcomeOK,
+	}, observer.Outcomes())
+}
+
+func TestObserver_OutdatedWithFallback(t *testing.T) {
+	// Setup
+	var (
+		testId   = "ThisIsMyID"
+		testType = TestType
+		ctx      = context.TODO()
+	)
+
+	// Mock
+	var (
+		inputItem             = &TestItem{ID: testId}
+		datastoreResponseItem = &TestItem{ID: testId, Version: 0}
+		serviceResponseItem   = &TestItem{ID: testId, Version: 1}
+		datastore             = &TestDatastore{}
+		fallbackService       = &TestService{}
+		observer              = &TestObserver{}
+	)
+
+	// Expect
+	datastore.On("Get", mock.Anything, MockModel(inputItem, testType)).Return(nil, MockModelWithItem(datastoreResponseItem, testType))
+	fallbackService.On("Get", mock.Anything, datastoreResponseItem).Return(nil, serviceResponseItem)
+	datastore.On("Save", mock.Anything, MockSavedModel(serviceResponseItem, testType)).Return(errors.New("error"))
+
+	// Apply
+	service := propagatedstorage.NewService(datastore, testType, 1, fallbackService, propagatedstorage.WithObserver(observer), propagatedstorage.WithClock(MockClock))
+	err := service.Get(ctx, inputItem)
+
+	// Assert
+	assert.NotNil(t, err)
+	assert.Equal(t, map[propagatedstorage.Stage]propagatedstorage.Outcome{
+		propagatedstorage.StageDatastoreGet: propagatedstorage.OutcomeHit,
+		propagatedstorage.StageVersionCheck: propagatedstorage.OutcomeOutdated,
+		propagatedstorage.StageFallback:     propagatedstorage.OutcomeOK,
+		propagatedstorage.StageWriteBack:    propagatedstorage.OutcomeError,
+	}, observer.Outcomes())
+}
@@ -0,0 +1,68 @@
+package opencensus
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+const pkgName = "github.com/Tanax/propagatedstorage"
+
+var (
+	// KeyType tags measurements with the propagated storage Type.
+	KeyType = tag.MustNewKey("propagatedstorage_type")
+	// KeyStage tags measurements with the stage of the operation.
+	KeyStage = tag.MustNewKey("propagatedstorage_stage")
+	// KeyOutcome tags measurements with how the stage ended.
+	KeyOutcome = tag.MustNewKey("propagatedstorage_outcome")
+
+	// LatencyMeasure is the latency of a single stage in milliseconds.
+	LatencyMeasure = stats.Float64(pkgName+"/latency", "Latency of a propagated storage stage", stats.UnitMilliseconds)
+
+	// LatencyView is the distribution of stage latencies per Type, stage and outcome.
+	LatencyView = &view.View{
+		Name:        pkgName + "/latency",
+		Measure:     LatencyMeasure,
+		Description: "Distribution of propagated storage stage latencies, by Type, stage and outcome.",
+		TagKeys:     []tag.Key{KeyType, KeyStage, KeyOutcome},
+		Aggregation: view.Distribution(0, 1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000),
+	}
+	// CompletedView is the number of completed stages per Type, stage and outcome. Hits, misses,
+	// outdated items and fallbacks can all be read from it.
+	CompletedView = &view.View{
+		Name:        pkgName + "/completed_count",
+		Measure:     LatencyMeasure,
+		Description: "Count of propagated storage stages, by Type, stage and outcome.",
+		TagKeys:     []tag.Key{KeyType, KeyStage, KeyOutcome},
+		Aggregation: view.Count(),
+	}
+
+	// Views are all views provided by this package. They must be registered with view.Register
+	// before any data is collected.
+	Views = []*view.View{LatencyView, CompletedView}
+)
+
+// Observer is a propagated storage observer that records every stage as OpenCensus stats.
+type Observer struct{}
+
+// NewObserver returns a new OpenCensus observer.
+func NewObserver() *Observer {
+	return &Observer{}
+}
+
+// Observe records the latency and outcome of a stage, tagged with its Type.
+func (o *Observer) Observe(ctx context.Context, event propagatedstorage.Event) {
+	mutators := []tag.Mutator{
+		tag.Upsert(KeyType, string(event.Type)),
+		tag.Upsert(KeyStage, string(event.Stage)),
+		tag.Upsert(KeyOutcome, string(event.Outcome)),
+	}
+
+	// Recording only fails on invalid tag values, which would be a bug in the Type name; losing a
+	// single measurement is preferable to failing the storage operation.
+	_ = stats.RecordWithTags(ctx, mutators, LatencyMeasure.M(float64(event.Duration)/float64(time.Millisecond)))
+}
@@ -0,0 +1,48 @@
+package opencensus_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/opencensus"
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/stats/view"
+)
+
+func TestObserver_RecordsPerType(t *testing.T) {
+	// Setup
+	assert.Nil(t, view.Register(opencensus.Views...))
+	defer view.Unregister(opencensus.Views...)
+
+	var (
+		ctx      = context.TODO()
+		observer = opencensus.NewObserver()
+	)
+
+	// Apply
+	observer.Observe(ctx, propagatedstorage.Event{Type: "TypeA", Stage: propagatedstorage.StageDatastoreGet, Outcome: propagatedstorage.OutcomeMiss, Duration: time.Millisecond})
+	observer.Observe(ctx, propagatedstorage.Event{Type: "TypeA", Stage: propagatedstorage.StageDatastoreGet, Outcome: propagatedstorage.OutcomeMiss, Duration: time.Millisecond})
+	observer.Observe(ctx, propagatedstorage.Event{Type: "TypeB", Stage: propagatedstorage.StageFallback, Outcome: propagatedstorage.OutcomeOK, Duration: time.Millisecond})
+
+	// Assert
+	rows, err := view.RetrieveData(opencensus.CompletedView.Name)
+	assert.Nil(t, err)
+
+	counts := make(map[string]int64)
+	for _, row := range rows {
+		var itemType, stage string
+		for _, tg := range row.Tags {
+			switch tg.Key {
+			case opencensus.KeyType:
+				itemType = tg.Value
+			case opencensus.KeyStage:
+				stage = tg.Value
+			}
+		}
+		counts[itemType+"/"+stage] = row.Data.(*view.CountData).Value
+	}
+
+	assert.Equal(t, map[string]int64{"TypeA/datastore.get": 2, "TypeB/fallback": 1}, counts)
+}
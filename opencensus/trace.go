@@ -0,0 +1,71 @@
+package opencensus
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+	"go.opencensus.io/trace"
+)
+
+// InjectTraceContext writes the span carried by ctx into the W3C trace context headers of req. Fallback
+// services that call the owning service over HTTP should call it on their outgoing request, using the
+// context passed to their Get, so the owning service continues the same trace.
+func InjectTraceContext(ctx context.Context, req *http.Request) {
+	span := trace.FromContext(ctx)
+	if span == nil {
+		return
+	}
+
+	format := &tracecontext.HTTPFormat{}
+	format.SpanContextToRequest(span.SpanContext(), req)
+}
+
+// SpanRecorder is a trace exporter that keeps every exported span in memory, so spans can be asserted
+// in unit tests.
+type SpanRecorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+// NewSpanRecorder creates a span recorder and registers it as a trace exporter. Call Close to
+// unregister it again.
+func NewSpanRecorder() *SpanRecorder {
+	recorder := new(SpanRecorder)
+	trace.RegisterExporter(recorder)
+
+	return recorder
+}
+
+// ExportSpan records the span.
+func (r *SpanRecorder) ExportSpan(span *trace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.spans = append(r.spans, span)
+}
+
+// Spans returns all spans recorded so far, in the order they ended.
+func (r *SpanRecorder) Spans() []*trace.SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	spans := make([]*trace.SpanData, len(r.spans))
+	copy(spans, r.spans)
+
+	return spans
+}
+
+// Reset forgets all spans recorded so far.
+func (r *SpanRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.spans = nil
+}
+
+// Close unregisters the recorder as a trace exporter.
+func (r *SpanRecorder) Close() {
+	trace.UnregisterExporter(r)
+}
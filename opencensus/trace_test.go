@@ -0,0 +1,110 @@
+package opencensus_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/opencensus"
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/trace"
+)
+
+type testItem struct {
+	id      string
+	version int
+}
+
+func (ti *testItem) GetCurrentVersion() int {
+	return ti.version
+}
+
+func (ti *testItem) GetID() string {
+	return ti.id
+}
+
+func (ti *testItem) PopulateFromItem(item propagatedstorage.Item) error {
+	ti.version = item.GetCurrentVersion()
+	return nil
+}
+
+type testDatastore struct {
+	stored *testItem
+}
+
+func (ds *testDatastore) Get(ctx context.Context, model *propagatedstorage.Model) error {
+	if ds.stored != nil {
+		model.Item = ds.stored
+		model.Version = ds.stored.version
+	}
+	return nil
+}
+
+func (ds *testDatastore) Save(ctx context.Context, model *propagatedstorage.Model) error {
+	return nil
+}
+
+type testService struct {
+	header http.Header
+}
+
+func (ts *testService) Get(ctx context.Context, item propagatedstorage.Item) error {
+	req, _ := http.NewRequest(http.MethodGet, "http://owner", nil)
+	opencensus.InjectTraceContext(ctx, req)
+	ts.header = req.Header
+
+	return errors.New("error")
+}
+
+func (ts *testService) Save(ctx context.Context, item propagatedstorage.Item) error {
+	return nil
+}
+
+func TestTrace_SpansPerStage(t *testing.T) {
+	// Setup
+	recorder := opencensus.NewSpanRecorder()
+	defer recorder.Close()
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+
+	var (
+		ctx       = context.TODO()
+		datastore = &testDatastore{stored: &testItem{id: "ThisIsMyID", version: 1}}
+		fallback  = &testService{}
+	)
+
+	// Apply
+	service := propagatedstorage.NewService(datastore, "TestType", 2, fallback)
+	err := service.Get(ctx, &testItem{id: "ThisIsMyID"})
+
+	// Assert
+	assert.NotNil(t, err)
+
+	spans := make(map[string]*trace.SpanData)
+	for _, span := range recorder.Spans() {
+		spans[span.Name] = span
+	}
+
+	get := spans["github.com/Tanax/propagatedstorage.Service.Get"]
+	assert.NotNil(t, get)
+	assert.Equal(t, "TestType", get.Attributes[propagatedstorage.AttributeType])
+	assert.Equal(t, "ThisIsMyID", get.Attributes[propagatedstorage.AttributeID])
+	assert.Equal(t, int64(2), get.Attributes[propagatedstorage.AttributeRequiredVersion])
+	assert.Equal(t, int64(1), get.Attributes[propagatedstorage.AttributeStoredVersion])
+	assert.Equal(t, string(propagatedstorage.OutcomeError), get.Attributes[propagatedstorage.AttributeOutcome])
+
+	datastoreGet := spans["github.com/Tanax/propagatedstorage.datastore.get"]
+	assert.NotNil(t, datastoreGet)
+	assert.Equal(t, get.SpanID, datastoreGet.ParentSpanID)
+	assert.Equal(t, string(propagatedstorage.OutcomeHit), datastoreGet.Attributes[propagatedstorage.AttributeOutcome])
+
+	versionCheck := spans["github.com/Tanax/propagatedstorage.version.check"]
+	assert.NotNil(t, versionCheck)
+	assert.Equal(t, string(propagatedstorage.OutcomeOutdated), versionCheck.Attributes[propagatedstorage.AttributeOutcome])
+
+	fallbackSpan := spans["github.com/Tanax/propagatedstorage.fallback"]
+	assert.NotNil(t, fallbackSpan)
+	assert.Equal(t, int32(trace.StatusCodeUnknown), fallbackSpan.Status.Code)
+	assert.Contains(t, fallback.header.Get("traceparent"), fallbackSpan.SpanID.String())
+}
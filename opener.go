@@ -0,0 +1,108 @@
+package propagatedstorage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// DatastoreURLOpener opens the datastores of URLs of the schemes it is registered for.
+type DatastoreURLOpener interface {
+	OpenDatastoreURL(ctx context.Context, u *url.URL) (Datastore, error)
+}
+
+// URLMux opens datastores by URL, dispatching on the scheme of the URL to the opener registered for it.
+// It is safe for concurrent use.
+type URLMux struct {
+	mu      sync.RWMutex
+	openers map[string]DatastoreURLOpener
+}
+
+var defaultURLMux = new(URLMux)
+
+// DefaultURLMux returns the URLMux used by OpenDatastore. Datastore packages register their schemes
+// on it when they are imported.
+func DefaultURLMux() *URLMux {
+	return defaultURLMux
+}
+
+// OpenDatastore opens the datastore identified by urlstr through the DefaultURLMux, for instance
+// "dynamodb://table?region=eu-west-1", "mem://" or "file:///var/lib/propagatedstorage.db". The package
+// of the datastore must be imported for its scheme to be registered.
+func OpenDatastore(ctx context.Context, urlstr string) (Datastore, error) {
+	return defaultURLMux.OpenDatastore(ctx, urlstr)
+}
+
+// RegisterDatastore registers opener for scheme. It panics if scheme is already registered, as two
+// packages claiming the same scheme is a programming error.
+func (m *URLMux) RegisterDatastore(scheme string, opener DatastoreURLOpener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.openers == nil {
+		m.openers = make(map[string]DatastoreURLOpener)
+	}
+	if _, ok := m.openers[scheme]; ok {
+		panic(fmt.Sprintf("propagatedstorage: scheme %q already registered", scheme))
+	}
+	m.openers[scheme] = opener
+}
+
+// DatastoreSchemes returns the registered schemes in alphabetical order.
+func (m *URLMux) DatastoreSchemes() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	schemes := make([]string, 0, len(m.openers))
+	for scheme := range m.openers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+
+	return schemes
+}
+
+// OpenDatastore parses urlstr and opens the datastore it identifies.
+func (m *URLMux) OpenDatastore(ctx context.Context, urlstr string) (Datastore, error) {
+	u, err := url.Parse(urlstr)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse datastore URL: %w", err)
+	}
+	return m.OpenDatastoreURL(ctx, u)
+}
+
+// OpenDatastoreURL opens the datastore identified by u. It fails with ErrUnsupported if no opener is
+// registered for the scheme of u.
+func (m *URLMux) OpenDatastoreURL(ctx context.Context, u *url.URL) (Datastore, error) {
+	m.mu.RLock()
+	opener, ok := m.openers[u.Scheme]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrUnsupported.Wrap(fmt.Errorf("no datastore registered for scheme %q", u.Scheme))
+	}
+
+	datastore, err := opener.OpenDatastoreURL(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s datastore: %w", u.Scheme, err)
+	}
+	return datastore, nil
+}
+
+// CheckURLParams fails if u has query parameters other than allowed, so typos in datastore URLs
+// don't go unnoticed. It is meant for DatastoreURLOpeners.
+func CheckURLParams(u *url.URL, allowed ...string) error {
+	known := make(map[string]bool, len(allowed))
+	for _, param := range allowed {
+		known[param] = true
+	}
+
+	for param := range u.Query() {
+		if !known[param] {
+			return fmt.Errorf("unknown query parameter %q", param)
+		}
+	}
+	return nil
+}
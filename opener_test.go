@@ -0,0 +1,83 @@
+package propagatedstorage_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/memstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type openerFunc func(ctx context.Context, u *url.URL) (propagatedstorage.Datastore, error)
+
+func (f openerFunc) OpenDatastoreURL(ctx context.Context, u *url.URL) (propagatedstorage.Datastore, error) {
+	return f(ctx, u)
+}
+
+func TestURLMux_OpenDatastore(t *testing.T) {
+	// Setup
+	var (
+		mux      = new(propagatedstorage.URLMux)
+		opened   *url.URL
+		expected = memstore.New()
+	)
+	mux.RegisterDatastore("test", openerFunc(func(ctx context.Context, u *url.URL) (propagatedstorage.Datastore, error) {
+		opened = u
+		return expected, nil
+	}))
+
+	// Apply
+	datastore, err := mux.OpenDatastore(context.TODO(), "test://table?region=eu-west-1")
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Same(t, expected, datastore)
+	require.NotNil(t, opened)
+	assert.Equal(t, "table", opened.Host)
+	assert.Equal(t, "eu-west-1", opened.Query().Get("region"))
+	assert.Equal(t, []string{"test"}, mux.DatastoreSchemes())
+}
+
+func TestURLMux_UnknownScheme(t *testing.T) {
+	// Apply
+	_, err := new(propagatedstorage.URLMux).OpenDatastore(context.TODO(), "unknown://table")
+
+	// Assert
+	assert.True(t, errors.Is(err, propagatedstorage.ErrUnsupported))
+}
+
+func TestURLMux_OpenerError(t *testing.T) {
+	// Setup
+	mux := new(propagatedstorage.URLMux)
+	mux.RegisterDatastore("test", openerFunc(func(ctx context.Context, u *url.URL) (propagatedstorage.Datastore, error) {
+		return nil, propagatedstorage.CheckURLParams(u, "region")
+	}))
+
+	// Apply
+	_, err := mux.OpenDatastore(context.TODO(), "test://table?regoin=eu-west-1")
+
+	// Assert
+	assert.EqualError(t, err, `could not open test datastore: unknown query parameter "regoin"`)
+}
+
+func TestURLMux_DuplicateScheme(t *testing.T) {
+	// Setup
+	mux := new(propagatedstorage.URLMux)
+	mux.RegisterDatastore("test", openerFunc(nil))
+
+	// Apply & Assert
+	assert.Panics(t, func() { mux.RegisterDatastore("test", openerFunc(nil)) })
+}
+
+func TestOpenDatastore_Registered(t *testing.T) {
+	// Apply
+	datastore, err := propagatedstorage.OpenDatastore(context.TODO(), "mem://")
+
+	// Assert
+	assert.Nil(t, err)
+	assert.IsType(t, &memstore.Datastore{}, datastore)
+}
@@ -0,0 +1,112 @@
+package propagatedstoragetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/documentstore"
+	"gocloud.dev/docstore"
+	"gocloud.dev/docstore/memdocstore"
+)
+
+// errNotFound is an error with the gcerrors.NotFound code, which collections return for documents that
+// are not stored. Only the Go CDK can create such errors, so it is the error of getting a document from
+// an empty memdocstore collection.
+var errNotFound = func() error {
+	coll, err := memdocstore.OpenCollection("ID", nil)
+	if err != nil {
+		panic(err)
+	}
+	defer coll.Close()
+
+	return coll.Get(context.Background(), map[string]interface{}{"ID": "missing"})
+}()
+
+type collectionKey struct {
+	itemType propagatedstorage.Type
+	id       string
+}
+
+// FakeCollection is an in-memory documentstore collection keyed by Type and ID, like the DynamoDB
+// table. It only accepts *documentstore.Entity documents and is safe for concurrent use. Like docstore
+// collections, it fails to get entities that are not stored with a gcerrors.NotFound error.
+type FakeCollection struct {
+	mu       sync.RWMutex
+	entities map[collectionKey]documentstore.Entity
+}
+
+// NewFakeCollection creates a new, empty fake collection.
+func NewFakeCollection() *FakeCollection {
+	return &FakeCollection{
+		entities: make(map[collectionKey]documentstore.Entity),
+	}
+}
+
+// Get populates document with the stored entity of the same Type and ID. Field paths are ignored.
+func (c *FakeCollection) Get(ctx context.Context, document interface{}, fps ...docstore.FieldPath) error {
+	entity, err := c.entity(ctx, document)
+	if err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	stored, ok := c.entities[collectionKey{entity.Type, entity.ID}]
+	c.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("entity of type %s and ID %s: %w", entity.Type, entity.ID, errNotFound)
+	}
+
+	*entity = stored
+	return nil
+}
+
+// Put stores a copy of document, replacing any entity of the same Type and ID.
+func (c *FakeCollection) Put(ctx context.Context, document interface{}) error {
+	entity, err := c.entity(ctx, document)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entities[collectionKey{entity.Type, entity.ID}] = *entity
+	return nil
+}
+
+// Delete removes the stored entity of the same Type and ID as document.
+func (c *FakeCollection) Delete(ctx context.Context, document interface{}) error {
+	entity, err := c.entity(ctx, document)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entities, collectionKey{entity.Type, entity.ID})
+	return nil
+}
+
+// Len returns the number of stored entities.
+func (c *FakeCollection) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.entities)
+}
+
+func (c *FakeCollection) entity(ctx context.Context, document interface{}) (*documentstore.Entity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	entity, ok := document.(*documentstore.Entity)
+	if !ok {
+		return nil, fmt.Errorf("unsupported document %T", document)
+	}
+	return entity, nil
+}
@@ -0,0 +1,19 @@
+package propagatedstoragetest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Tanax/propagatedstorage/documentstore"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
+	"github.com/stretchr/testify/assert"
+	"gocloud.dev/gcerrors"
+)
+
+func TestFakeCollection_NotFound(t *testing.T) {
+	// Apply
+	err := propagatedstoragetest.NewFakeCollection().Get(context.TODO(), &documentstore.Entity{Type: "MyType", ID: "ThisIsMyID"})
+
+	// Assert
+	assert.Equal(t, gcerrors.NotFound, gcerrors.Code(err))
+}
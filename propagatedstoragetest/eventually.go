@@ -0,0 +1,23 @@
+package propagatedstoragetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Eventually polls condition until it holds, failing t if it does not within a second. Tests use it
+// over assert.Eventually, which in the testify version in use may panic when a poll outlasts its tick.
+func Eventually(t testing.TB, condition func() bool, msgAndArgs ...interface{}) bool {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return assert.Fail(t, "condition never satisfied", msgAndArgs...)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
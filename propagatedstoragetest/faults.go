@@ -0,0 +1,252 @@
+package propagatedstoragetest
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+)
+
+// ErrInjectedFault is the default error injected by the faulty wrappers.
+var ErrInjectedFault = propagatedstorage.NewError("injected fault")
+
+// LatencyDistribution draws the latency of a single call from rnd.
+type LatencyDistribution func(rnd *rand.Rand) time.Duration
+
+// UniformLatency returns latencies uniformly distributed between min and max.
+func UniformLatency(min, max time.Duration) LatencyDistribution {
+	return func(rnd *rand.Rand) time.Duration {
+		if max <= min {
+			return min
+		}
+		return min + time.Duration(rnd.Int63n(int64(max-min)))
+	}
+}
+
+// ExponentialLatency returns exponentially distributed latencies with the given mean, which models
+// the long tail of a remote service.
+func ExponentialLatency(mean time.Duration) LatencyDistribution {
+	return func(rnd *rand.Rand) time.Duration {
+		return time.Duration(rnd.ExpFloat64() * float64(mean))
+	}
+}
+
+// Faults configures the faults injected into every call of a FaultyDatastore or FaultyService. All
+// rates are probabilities between 0 and 1.
+type Faults struct {
+	// Seed seeds the random source, so the same seed injects the same faults into the same sequence
+	// of calls.
+	Seed int64
+	// ErrorRate is the probability that a call fails with Err.
+	ErrorRate float64
+	// Err is the error injected into failing calls. Defaults to ErrInjectedFault.
+	Err error
+	// Latency delays every call. No latency is added if nil.
+	Latency LatencyDistribution
+	// TimeoutRate is the probability that a call hangs until its context is done.
+	TimeoutRate float64
+	// BatchErrorRate is the probability that a single model of a batch fails with Err while the
+	// rest of the batch is saved.
+	BatchErrorRate float64
+}
+
+type injector struct {
+	faults Faults
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newInjector(faults Faults) *injector {
+	if faults.Err == nil {
+		faults.Err = ErrInjectedFault
+	}
+
+	return &injector{
+		faults: faults,
+		rnd:    rand.New(rand.NewSource(faults.Seed)),
+	}
+}
+
+// inject draws the faults of a single call and applies them. It returns the error the call should
+// fail with, if any.
+func (i *injector) inject(ctx context.Context) error {
+	i.mu.Lock()
+	var latency time.Duration
+	if i.faults.Latency != nil {
+		latency = i.faults.Latency(i.rnd)
+	}
+	timeout := i.rnd.Float64() < i.faults.TimeoutRate
+	fail := i.rnd.Float64() < i.faults.ErrorRate
+	i.mu.Unlock()
+
+	if timeout {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if fail {
+		return i.faults.Err
+	}
+	return nil
+}
+
+// failBatchItem draws whether a single model of a batch fails.
+func (i *injector) failBatchItem() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.rnd.Float64() < i.faults.BatchErrorRate
+}
+
+// FaultyDatastore is a datastore that injects faults before passing calls on to another datastore.
+type FaultyDatastore struct {
+	datastore propagatedstorage.Datastore
+	injector  *injector
+}
+
+// NewFaultyDatastore wraps datastore in a FaultyDatastore injecting faults.
+func NewFaultyDatastore(datastore propagatedstorage.Datastore, faults Faults) *FaultyDatastore {
+	return &FaultyDatastore{
+		datastore: datastore,
+		injector:  newInjector(faults),
+	}
+}
+
+// Get injects faults, then gets model from the wrapped datastore.
+func (ds *FaultyDatastore) Get(ctx context.Context, model *propagatedstorage.Model) error {
+	if err := ds.injector.inject(ctx); err != nil {
+		return err
+	}
+	return ds.datastore.Get(ctx, model)
+}
+
+// Save injects faults, then saves model to the wrapped datastore.
+func (ds *FaultyDatastore) Save(ctx context.Context, model *propagatedstorage.Model) error {
+	if err := ds.injector.inject(ctx); err != nil {
+		return err
+	}
+	return ds.datastore.Save(ctx, model)
+}
+
+// Delete injects faults, then deletes model from the wrapped datastore.
+func (ds *FaultyDatastore) Delete(ctx context.Context, model *propagatedstorage.Model) error {
+	if err := ds.injector.inject(ctx); err != nil {
+		return err
+	}
+	return propagatedstorage.Delete(ctx, ds.datastore, model)
+}
+
+// ScanIDs injects faults, then scans the IDs stored in the wrapped datastore.
+func (ds *FaultyDatastore) ScanIDs(ctx context.Context, itemType propagatedstorage.Type, fn func(id string) error) error {
+	if err := ds.injector.inject(ctx); err != nil {
+		return err
+	}
+	return propagatedstorage.ScanIDs(ctx, ds.datastore, itemType, fn)
+}
+
+// List injects faults, then lists the models stored in the wrapped datastore.
+func (ds *FaultyDatastore) List(ctx context.Context, itemType propagatedstorage.Type, filter propagatedstorage.ListFilter, pageToken string) (*propagatedstorage.Page, error) {
+	if err := ds.injector.inject(ctx); err != nil {
+		return nil, err
+	}
+	return propagatedstorage.List(ctx, ds.datastore, itemType, filter, pageToken)
+}
+
+// ChangedSince injects faults, then lists the models changed in the wrapped datastore.
+func (ds *FaultyDatastore) ChangedSince(ctx context.Context, itemType propagatedstorage.Type, since time.Time, cursor string) (*propagatedstorage.Changes, error) {
+	if err := ds.injector.inject(ctx); err != nil {
+		return nil, err
+	}
+	return propagatedstorage.ChangedSince(ctx, ds.datastore, itemType, since, cursor)
+}
+
+// Close closes the wrapped datastore without injecting faults.
+func (ds *FaultyDatastore) Close(ctx context.Context) error {
+	return propagatedstorage.CloseAll(ctx, ds.datastore)
+}
+
+// SaveBatch injects faults into the call as a whole and into every model of the batch, then saves the
+// models that did not fail to the wrapped datastore.
+func (ds *FaultyDatastore) SaveBatch(ctx context.Context, models []*propagatedstorage.Model) error {
+	if err := ds.injector.inject(ctx); err != nil {
+		return err
+	}
+
+	errs := make(map[int]error)
+	var (
+		passed  []*propagatedstorage.Model
+		indexes []int
+	)
+	for i, model := range models {
+		if ds.injector.failBatchItem() {
+			errs[i] = ds.injector.faults.Err
+			continue
+		}
+		passed = append(passed, model)
+		indexes = append(indexes, i)
+	}
+
+	if err := propagatedstorage.SaveBatch(ctx, ds.datastore, passed); err != nil {
+		batchErr, ok := err.(*propagatedstorage.BatchError)
+		if !ok {
+			return err
+		}
+		for i, err := range batchErr.Errors {
+			errs[indexes[i]] = err
+		}
+	}
+
+	if len(errs) > 0 {
+		return &propagatedstorage.BatchError{Errors: errs}
+	}
+	return nil
+}
+
+// FaultyService is a service that injects faults before passing calls on to another service.
+type FaultyService struct {
+	service  propagatedstorage.Service
+	injector *injector
+}
+
+// NewFaultyService wraps service in a FaultyService injecting faults.
+func NewFaultyService(service propagatedstorage.Service, faults Faults) *FaultyService {
+	return &FaultyService{
+		service:  service,
+		injector: newInjector(faults),
+	}
+}
+
+// Get injects faults, then gets item from the wrapped service.
+func (s *FaultyService) Get(ctx context.Context, item propagatedstorage.Item) error {
+	if err := s.injector.inject(ctx); err != nil {
+		return err
+	}
+	return s.service.Get(ctx, item)
+}
+
+// Save injects faults, then saves item to the wrapped service.
+func (s *FaultyService) Save(ctx context.Context, item propagatedstorage.Item) error {
+	if err := s.injector.inject(ctx); err != nil {
+		return err
+	}
+	return s.service.Save(ctx, item)
+}
+
+// Close closes the wrapped service without injecting faults.
+func (s *FaultyService) Close(ctx context.Context) error {
+	return propagatedstorage.CloseAll(ctx, s.service)
+}
@@ -0,0 +1,110 @@
+package propagatedstoragetest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/memstore"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func failurePattern(faults propagatedstoragetest.Faults, calls int) []bool {
+	var (
+		ctx       = context.TODO()
+		datastore = propagatedstoragetest.NewFaultyDatastore(memstore.New(), faults)
+		pattern   = make([]bool, calls)
+	)
+
+	for i := range pattern {
+		model := propagatedstorage.NewModel(fmt.Sprintf("ID%d", i), testType, 1)
+		pattern[i] = errors.Is(datastore.Save(ctx, model), propagatedstoragetest.ErrInjectedFault)
+	}
+	return pattern
+}
+
+func TestFaultyDatastore_DeterministicSeed(t *testing.T) {
+	// Setup
+	faults := propagatedstoragetest.Faults{Seed: 42, ErrorRate: 0.5}
+
+	// Apply
+	first := failurePattern(faults, 100)
+	second := failurePattern(faults, 100)
+
+	// Assert
+	assert.Equal(t, first, second)
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+}
+
+func TestFaultyDatastore_Timeout(t *testing.T) {
+	// Setup
+	var (
+		ctx, cancel = context.WithTimeout(context.TODO(), 10*time.Millisecond)
+		datastore   = propagatedstoragetest.NewFaultyDatastore(memstore.New(), propagatedstoragetest.Faults{TimeoutRate: 1})
+	)
+	defer cancel()
+
+	// Apply
+	err := datastore.Get(ctx, propagatedstorage.NewModel("ThisIsMyID", testType, 0))
+
+	// Assert
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestFaultyDatastore_PartialBatch(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		backing   = memstore.New()
+		datastore = propagatedstoragetest.NewFaultyDatastore(backing, propagatedstoragetest.Faults{Seed: 7, BatchErrorRate: 0.5})
+		models    = make([]*propagatedstorage.Model, 20)
+	)
+
+	for i := range models {
+		models[i] = propagatedstorage.NewModel(fmt.Sprintf("ID%d", i), testType, 1)
+	}
+
+	// Apply
+	err := propagatedstorage.SaveBatch(ctx, datastore, models)
+
+	// Assert
+	var batchErr *propagatedstorage.BatchError
+	assert.True(t, errors.As(err, &batchErr))
+	assert.True(t, errors.Is(err, propagatedstoragetest.ErrInjectedFault))
+	assert.NotEmpty(t, batchErr.Errors)
+	assert.Equal(t, len(models)-len(batchErr.Errors), backing.Len())
+
+	for i, model := range models {
+		_, failed := batchErr.Errors[i]
+		getErr := backing.Get(ctx, propagatedstorage.NewModel(model.ID, testType, 0))
+		assert.Equal(t, failed, errors.Is(getErr, propagatedstorage.ErrNotFound))
+	}
+}
+
+func TestFaultyService_FallbackFailure(t *testing.T) {
+	// Setup
+	var (
+		ctx      = context.TODO()
+		fallback = propagatedstoragetest.NewFakeService()
+		faulty   = propagatedstoragetest.NewFaultyService(fallback, propagatedstoragetest.Faults{
+			ErrorRate: 1,
+			Latency:   propagatedstoragetest.UniformLatency(time.Millisecond, 2*time.Millisecond),
+		})
+		service = propagatedstorage.NewService(memstore.New(), testType, 1, faulty)
+	)
+
+	fallback.SetItem(propagatedstoragetest.NewItem(testType, "ThisIsMyID", 1, ""))
+
+	// Apply
+	err := service.Get(ctx, &propagatedstoragetest.Item{ID: "ThisIsMyID"})
+
+	// Assert
+	assert.True(t, errors.Is(err, propagatedstorage.ErrServiceFailed))
+	assert.True(t, errors.Is(err, propagatedstoragetest.ErrInjectedFault))
+	assert.Empty(t, fallback.Calls())
+}
@@ -0,0 +1,60 @@
+// Package propagatedstoragetest provides fakes for testing code that builds on propagated storage: a
+// generic Item, a programmable fallback Service and an in-memory documentstore Collection.
+package propagatedstoragetest
+
+import (
+	"fmt"
+
+	"github.com/Tanax/propagatedstorage"
+)
+
+// Item is a generic propagated item. It implements propagatedstorage.TypedItem, so it can be passed to
+// a Router, and is a propagatedstorage.Cloner.
+type Item struct {
+	ID      string
+	Type    propagatedstorage.Type
+	Version int
+	Payload string
+}
+
+// NewItem creates a new item.
+func NewItem(itemType propagatedstorage.Type, id string, version int, payload string) *Item {
+	return &Item{
+		ID:      id,
+		Type:    itemType,
+		Version: version,
+		Payload: payload,
+	}
+}
+
+// GetCurrentVersion returns the version of the item.
+func (i *Item) GetCurrentVersion() int {
+	return i.Version
+}
+
+// GetID returns the ID of the item.
+func (i *Item) GetID() string {
+	return i.ID
+}
+
+// GetType returns the Type of the item.
+func (i *Item) GetType() propagatedstorage.Type {
+	return i.Type
+}
+
+// PopulateFromItem copies another *Item into the item.
+func (i *Item) PopulateFromItem(item propagatedstorage.Item) error {
+	other, ok := item.(*Item)
+	if !ok {
+		return fmt.Errorf("cannot populate item from %T", item)
+	}
+
+	*i = *other
+	return nil
+}
+
+// Clone returns a copy of the item.
+func (i *Item) Clone() propagatedstorage.Item {
+	c := *i
+	return &c
+}
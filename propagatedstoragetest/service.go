@@ -0,0 +1,155 @@
+package propagatedstoragetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+)
+
+// Call is a call received by a FakeService.
+type Call struct {
+	Operation propagatedstorage.Operation
+	ID        string
+	Item      propagatedstorage.Item
+}
+
+// FakeService is a programmable fallback service. It answers Get with the item programmed for the ID,
+// and with propagatedstorage.ErrNotFound for IDs it knows nothing about. Every call is recorded. A
+// FakeService is safe for concurrent use.
+type FakeService struct {
+	mu        sync.Mutex
+	items     map[string]propagatedstorage.Item
+	errs      map[string]error
+	latencies map[string]time.Duration
+	err       error
+	latency   time.Duration
+	calls     []Call
+}
+
+// NewFakeService creates a new fake service that knows no items.
+func NewFakeService() *FakeService {
+	return &FakeService{
+		items:     make(map[string]propagatedstorage.Item),
+		errs:      make(map[string]error),
+		latencies: make(map[string]time.Duration),
+	}
+}
+
+// SetItem programs the item returned for its ID.
+func (s *FakeService) SetItem(item propagatedstorage.Item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items[item.GetID()] = item
+}
+
+// SetError programs the error returned for id. A nil err clears it.
+func (s *FakeService) SetError(id string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		delete(s.errs, id)
+		return
+	}
+	s.errs[id] = err
+}
+
+// SetDefaultError programs the error returned for every ID without an error of its own. A nil err
+// clears it.
+func (s *FakeService) SetDefaultError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+// SetLatency programs how long every call for id takes.
+func (s *FakeService) SetLatency(id string, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latencies[id] = latency
+}
+
+// SetDefaultLatency programs how long every call for an ID without a latency of its own takes.
+func (s *FakeService) SetDefaultLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = latency
+}
+
+// Calls returns the calls received so far, in order.
+func (s *FakeService) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	calls := make([]Call, len(s.calls))
+	copy(calls, s.calls)
+
+	return calls
+}
+
+// Get populates item with the item programmed for its ID.
+func (s *FakeService) Get(ctx context.Context, item propagatedstorage.Item) error {
+	response, err := s.call(ctx, propagatedstorage.OperationServiceGet, item)
+	if err != nil {
+		return err
+	}
+	return item.PopulateFromItem(response)
+}
+
+// Save programs item as the item returned for its ID from then on.
+func (s *FakeService) Save(ctx context.Context, item propagatedstorage.Item) error {
+	if _, err := s.call(ctx, propagatedstorage.OperationServiceSave, item); err != nil && !errors.Is(err, propagatedstorage.ErrNotFound) {
+		return err
+	}
+
+	s.SetItem(item)
+	return nil
+}
+
+// call records the call, waits for its latency and returns the item and error programmed for its ID.
+func (s *FakeService) call(ctx context.Context, operation propagatedstorage.Operation, item propagatedstorage.Item) (propagatedstorage.Item, error) {
+	id := item.GetID()
+
+	s.mu.Lock()
+	s.calls = append(s.calls, Call{Operation: operation, ID: id, Item: item})
+
+	latency, ok := s.latencies[id]
+	if !ok {
+		latency = s.latency
+	}
+	err, ok := s.errs[id]
+	if !ok {
+		err = s.err
+	}
+	response, found := s.items[id]
+	s.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		e := propagatedstorage.ErrNotFound.Wrap(nil)
+		e.ID = id
+		return nil, e
+	}
+
+	return response, nil
+}
@@ -0,0 +1,86 @@
+package propagatedstoragetest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/memstore"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
+	"github.com/stretchr/testify/assert"
+)
+
+const testType propagatedstorage.Type = "TestType"
+
+func TestFakeService_PerIDResponses(t *testing.T) {
+	// Setup
+	var (
+		ctx      = context.TODO()
+		fallback = propagatedstoragetest.NewFakeService()
+		failure  = errors.New("error")
+	)
+
+	fallback.SetItem(propagatedstoragetest.NewItem(testType, "known", 2, "Heyhey"))
+	fallback.SetError("failing", failure)
+
+	// Apply
+	known := &propagatedstoragetest.Item{ID: "known"}
+	knownErr := fallback.Get(ctx, known)
+	failingErr := fallback.Get(ctx, &propagatedstoragetest.Item{ID: "failing"})
+	unknownErr := fallback.Get(ctx, &propagatedstoragetest.Item{ID: "unknown"})
+
+	// Assert
+	assert.Nil(t, knownErr)
+	assert.Equal(t, propagatedstoragetest.NewItem(testType, "known", 2, "Heyhey"), known)
+	assert.Equal(t, failure, failingErr)
+	assert.True(t, errors.Is(unknownErr, propagatedstorage.ErrNotFound))
+
+	calls := fallback.Calls()
+	assert.Len(t, calls, 3)
+	assert.Equal(t, propagatedstorage.OperationServiceGet, calls[0].Operation)
+	assert.Equal(t, "known", calls[0].ID)
+}
+
+func TestFakeService_Latency(t *testing.T) {
+	// Setup
+	var (
+		ctx, cancel = context.WithTimeout(context.TODO(), 10*time.Millisecond)
+		fallback    = propagatedstoragetest.NewFakeService()
+	)
+	defer cancel()
+
+	fallback.SetItem(propagatedstoragetest.NewItem(testType, "slow", 1, ""))
+	fallback.SetLatency("slow", time.Minute)
+
+	// Apply
+	err := fallback.Get(ctx, &propagatedstoragetest.Item{ID: "slow"})
+
+	// Assert
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestFakeService_AsFallback(t *testing.T) {
+	// Setup
+	var (
+		ctx      = context.TODO()
+		fallback = propagatedstoragetest.NewFakeService()
+		service  = propagatedstorage.NewService(memstore.New(), testType, 1, fallback)
+	)
+
+	fallback.SetItem(propagatedstoragetest.NewItem(testType, "ThisIsMyID", 1, "from owner"))
+
+	// Apply
+	first := &propagatedstoragetest.Item{ID: "ThisIsMyID"}
+	firstErr := service.Get(ctx, first)
+	second := &propagatedstoragetest.Item{ID: "ThisIsMyID"}
+	secondErr := service.Get(ctx, second)
+
+	// Assert
+	assert.Nil(t, firstErr)
+	assert.Nil(t, secondErr)
+	assert.Equal(t, "from owner", first.Payload)
+	assert.Equal(t, "from owner", second.Payload)
+	assert.Len(t, fallback.Calls(), 1)
+}
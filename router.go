@@ -0,0 +1,176 @@
+package propagatedstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Route is the configuration of a single Type within a Router.
+type Route struct {
+	// Datastore stores the propagated data of this Type. Defaults to the datastore of the router.
+	Datastore Datastore
+	// RequiredVersion is the version required for this Type, see NewService.
+	RequiredVersion int
+	// FallbackService is the service to fall back to for this Type, see NewService.
+	FallbackService Service
+	// Options are applied after the options of the router, so they take precedence.
+	Options []Option
+}
+
+// Router is a Service for items of several Types. It dispatches every call to the service registered
+// for the Type the item declares, so items passed to it must implement TypedItem. Types can be
+// registered and deregistered at any time, also while the router is in use.
+type Router struct {
+	datastore Datastore
+	options   []Option
+
+	mu       sync.RWMutex
+	services map[Type]Service
+	// shared holds the Types whose service uses the default datastore.
+	shared map[Type]bool
+}
+
+// NewRouter creates a new router. datastore is the default datastore of every registered Type and may be
+// nil if every route brings its own; opts are applied to the service of every registered Type.
+func NewRouter(datastore Datastore, opts ...Option) *Router {
+	return &Router{
+		datastore: datastore,
+		options:   opts,
+		services:  make(map[Type]Service),
+		shared:    make(map[Type]bool),
+	}
+}
+
+// Register adds itemType to the router, replacing its previous route if it was already registered. The
+// service of the previous route is closed, draining its write-back pool, but the default datastore is
+// left open for the other Types. Register fails if it could not be closed, with itemType registered
+// nonetheless.
+func (r *Router) Register(itemType Type, route Route) error {
+	datastore := route.Datastore
+	if datastore == nil {
+		datastore = r.datastore
+	}
+	if datastore == nil {
+		return fmt.Errorf("could not register type %s: %w", itemType, ErrMissingDatastore)
+	}
+
+	opts := make([]Option, 0, len(r.options)+len(route.Options))
+	opts = append(opts, r.options...)
+	opts = append(opts, route.Options...)
+
+	service := NewService(datastore, itemType, route.RequiredVersion, route.FallbackService, opts...)
+
+	r.mu.Lock()
+	previous, shared := r.services[itemType], r.shared[itemType]
+	r.services[itemType] = service
+	r.shared[itemType] = route.Datastore == nil
+	r.mu.Unlock()
+
+	if err := r.closeService(context.Background(), previous, shared); err != nil {
+		return fmt.Errorf("could not close the previous service of type %s: %w", itemType, err)
+	}
+	return nil
+}
+
+// Deregister removes itemType from the router and closes its service, as Register does with the
+// services it replaces. Calls for items of that Type fail from then on.
+func (r *Router) Deregister(ctx context.Context, itemType Type) error {
+	r.mu.Lock()
+	service, shared := r.services[itemType], r.shared[itemType]
+	delete(r.services, itemType)
+	delete(r.shared, itemType)
+	r.mu.Unlock()
+
+	if err := r.closeService(ctx, service, shared); err != nil {
+		return fmt.Errorf("could not close the service of type %s: %w", itemType, err)
+	}
+	return nil
+}
+
+// closeService closes a service the router no longer routes to. If it uses the default datastore,
+// only its write-back pool and fallback service are closed.
+func (r *Router) closeService(ctx context.Context, s Service, shared bool) error {
+	if s, ok := s.(*service); ok && shared {
+		values := []interface{}{s.fallbackService}
+		if s.writeBacks != nil {
+			values = append([]interface{}{s.writeBacks}, values...)
+		}
+		return CloseAll(ctx, values...)
+	}
+	return CloseAll(ctx, s)
+}
+
+// Types returns the registered Types in alphabetical order.
+func (r *Router) Types() []Type {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.types()
+}
+
+// types returns the registered Types in alphabetical order. The caller must hold the lock.
+func (r *Router) types() []Type {
+	types := make([]Type, 0, len(r.services))
+	for itemType := range r.services {
+		types = append(types, itemType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	return types
+}
+
+// Get retrieves the item through the service registered for its Type.
+func (r *Router) Get(ctx context.Context, item Item) error {
+	service, err := r.route(item)
+	if err != nil {
+		return err
+	}
+	return service.Get(ctx, item)
+}
+
+// Save stores the item through the service registered for its Type.
+func (r *Router) Save(ctx context.Context, item Item) error {
+	service, err := r.route(item)
+	if err != nil {
+		return err
+	}
+	return service.Save(ctx, item)
+}
+
+// Close closes the services of every registered Type, in alphabetical order, and then the default
+// datastore. Types deregistered before were closed when they were.
+func (r *Router) Close(ctx context.Context) error {
+	r.mu.RLock()
+	values := make([]interface{}, 0, len(r.services)+1)
+	for _, itemType := range r.types() {
+		values = append(values, r.services[itemType])
+	}
+	r.mu.RUnlock()
+
+	return CloseAll(ctx, append(values, r.datastore)...)
+}
+
+func (r *Router) route(item Item) (Service, error) {
+	typed, ok := item.(TypedItem)
+	if !ok {
+		e := ErrUnknownType.Wrap(errors.New("item does not declare its type"))
+		e.ID = item.GetID()
+		return nil, e
+	}
+
+	r.mu.RLock()
+	service, ok := r.services[typed.GetType()]
+	r.mu.RUnlock()
+
+	if !ok {
+		e := ErrUnknownType.Wrap(nil)
+		e.Type = typed.GetType()
+		e.ID = item.GetID()
+		return nil, e
+	}
+
+	return service, nil
+}
@@ -0,0 +1,87 @@
+package propagatedstorage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type TestTypedItem struct {
+	TestItem
+	Type propagatedstorage.Type
+}
+
+func (ti *TestTypedItem) GetType() propagatedstorage.Type {
+	return ti.Type
+}
+
+func TestRouter_DispatchByType(t *testing.T) {
+	// Setup
+	var (
+		ctx      = context.TODO()
+		typeA    = propagatedstorage.Type("TypeA")
+		typeB    = propagatedstorage.Type("TypeB")
+		itemA    = &TestTypedItem{TestItem: TestItem{ID: "A", Version: 1}, Type: typeA}
+		itemB    = &TestTypedItem{TestItem: TestItem{ID: "B", Version: 2}, Type: typeB}
+		defaults = &TestDatastore{}
+		custom   = &TestDatastore{}
+	)
+
+	// Expect
+	custom.On("Save", mock.Anything, mock.MatchedBy(func(model *propagatedstorage.Model) bool {
+		return model.ID == "B" && model.Type == typeB && model.Version == 2
+	})).Return(nil)
+	defaults.On("Save", mock.Anything, mock.MatchedBy(func(model *propagatedstorage.Model) bool {
+		return model.ID == "A" && model.Type == typeA && model.Version == 1
+	})).Return(nil)
+
+	// Apply
+	router := propagatedstorage.NewRouter(defaults)
+	assert.Nil(t, router.Register(typeA, propagatedstorage.Route{}))
+	assert.Nil(t, router.Register(typeB, propagatedstorage.Route{Datastore: custom}))
+
+	errA := router.Save(ctx, itemA)
+	errB := router.Save(ctx, itemB)
+
+	// Assert
+	defaults.AssertExpectations(t)
+	custom.AssertExpectations(t)
+
+	assert.Nil(t, errA)
+	assert.Nil(t, errB)
+	assert.Equal(t, []propagatedstorage.Type{typeA, typeB}, router.Types())
+}
+
+func TestRouter_UnknownType(t *testing.T) {
+	// Setup
+	var (
+		ctx    = context.TODO()
+		typeA  = propagatedstorage.Type("TypeA")
+		router = propagatedstorage.NewRouter(&TestDatastore{})
+	)
+
+	// Apply
+	assert.Nil(t, router.Register(typeA, propagatedstorage.Route{}))
+	assert.Nil(t, router.Deregister(context.TODO(), typeA))
+
+	errTyped := router.Get(ctx, &TestTypedItem{TestItem: TestItem{ID: "A"}, Type: typeA})
+	errUntyped := router.Get(ctx, &TestItem{ID: "A"})
+
+	// Assert
+	assert.True(t, errors.Is(errTyped, propagatedstorage.ErrUnknownType))
+	assert.True(t, errors.Is(errUntyped, propagatedstorage.ErrUnknownType))
+	assert.Empty(t, router.Types())
+}
+
+func TestRouter_MissingDatastore(t *testing.T) {
+	// Apply
+	router := propagatedstorage.NewRouter(nil)
+	err := router.Register("TypeA", propagatedstorage.Route{})
+
+	// Assert
+	assert.True(t, errors.Is(err, propagatedstorage.ErrMissingDatastore))
+}
@@ -2,7 +2,9 @@ package propagatedstorage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 )
 
 // Service represents how our service should look.
@@ -16,6 +18,69 @@ type service struct {
 	requiredVersion int
 	itemType        Type
 	fallbackService Service
+	observer        Observer
+	negative        *negativeCache
+	now             func() time.Time
+	writeBacks      *WriteBackPool
+	expiry          time.Duration
+}
+
+// Option configures optional behaviour of a propagated storage service.
+type Option func(s *service)
+
+// WithObserver sets the observer that is notified of every stage the service runs.
+func WithObserver(observer Observer) Option {
+	return func(s *service) {
+		s.observer = observer
+	}
+}
+
+// WithNegativeCache makes the service remember for ttl the IDs the fallback service reported as not
+// found. Gets for such an ID fail with ErrNotFound right away, without reading the datastore or asking
+// the fallback service again, until ttl has passed or the item is saved through the service.
+func WithNegativeCache(ttl time.Duration) Option {
+	return func(s *service) {
+		s.negative = newNegativeCache(ttl)
+	}
+}
+
+// WithPersistedNegativeCache works like WithNegativeCache, but also saves a tombstone, a model without
+// an item, to the datastore, so other instances sharing the datastore learn about the unknown ID too.
+// Tombstones are overwritten once the item is propagated, and expire ttl after they were saved, so
+// datastores that delete expired models, such as the DynamoDB one with a TTL attribute, drop them.
+func WithPersistedNegativeCache(ttl time.Duration) Option {
+	return func(s *service) {
+		s.negative = newNegativeCache(ttl)
+		s.negative.persist = true
+	}
+}
+
+// WithWriteBackPool makes the service write items fetched from the fallback service back to the
+// datastore on pool, instead of before Get returns. Failed write backs are reported to the error
+// handler of the pool rather than failing the Get. Items that are Cloners are copied before they are
+// queued; others are written back as they are, so the caller must not modify them while the write
+// back may still be underway.
+func WithWriteBackPool(pool *WriteBackPool) Option {
+	return func(s *service) {
+		s.writeBacks = pool
+	}
+}
+
+// WithExpiry makes items saved through the service expire ttl after they were saved. Gets treat
+// expired items as not stored and fetch them from the fallback service again. Items that are
+// ExpiringItems set their own expiry instead.
+func WithExpiry(ttl time.Duration) Option {
+	return func(s *service) {
+		s.expiry = ttl
+	}
+}
+
+// WithClock sets the clock used to expire what the service caches and saves, and to stamp the
+// models it saves as Modified. Defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(s *service) {
+		s.now = now
+	}
 }
 
 // NewService creates a new instance of a propagated storage service.
@@ -23,56 +88,242 @@ type service struct {
 // - fallbackService is the propagated storage service to fall back to if version is outdated, this is most likely a HTTP service client that asks service owning the data that is propagated
 // - requiredVersion is the version required for this propagation "contract", provides a way to resync data on the fly if they ever get out of sync
 // - itemType is the type of the propagated item
-func NewService(datastore Datastore, itemType Type, requiredVersion int, fallbackService Service) Service {
-	return &service{
+// - opts are optional settings such as an observer
+// The service is a Closer, closing what it was created with.
+func NewService(datastore Datastore, itemType Type, requiredVersion int, fallbackService Service, opts ...Option) Service {
+	s := &service{
 		datastore:       datastore,
 		requiredVersion: requiredVersion,
 		itemType:        itemType,
 		fallbackService: fallbackService,
+		now:             time.Now,
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 // Get retrieves propagated data based on the (propagated) item passed in. If a required version is configured, it will check that against what was stored in our propagated storage
-// and return an error if it's below the required version.
-func (s *service) Get(ctx context.Context, item Item) error {
+// and return an error if it's below the required version. Items that are outdated or not stored at all are fetched from the fallback service and written back.
+func (s *service) Get(ctx context.Context, item Item) (err error) {
 	model := NewModel(item.GetID(), s.itemType, item.GetCurrentVersion())
 
-	if err := s.datastore.Get(ctx, model); err != nil {
-		return fmt.Errorf("could not get propagated storage model: %w", ErrDatastoreFailed.Wrap(err))
+	ctx, span := s.startSpan(ctx, "Service.Get", model.ID)
+	defer func() { endSpan(span, model, outcomeOf(err), err) }()
+
+	if s.negative != nil {
+		known := false
+		s.runStage(ctx, StageNegativeCache, model, func(ctx context.Context) (Outcome, error) {
+			if known = s.negative.known(model.ID, s.now()); known {
+				return OutcomeHit, nil
+			}
+			return OutcomeMiss, nil
+		})
+		if known {
+			return fmt.Errorf("propagated item is unknown to the fallback service: %w", s.newError(ErrNotFound, StageNegativeCache, model, nil))
+		}
+	}
+
+	expired := false
+	err = s.runStage(ctx, StageDatastoreGet, model, func(ctx context.Context) (Outcome, error) {
+		if err := s.datastore.Get(ctx, model); err != nil && !errors.Is(err, ErrNotFound) {
+			return OutcomeError, err
+		}
+		if model.Item == nil {
+			return OutcomeMiss, nil
+		}
+		if model.Expired(s.now()) {
+			// The datastore may keep expired models for a while, as DynamoDB does.
+			model.Item = nil
+			expired = true
+			return OutcomeExpired, nil
+		}
+		return OutcomeHit, nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not get propagated storage model: %w", s.newError(ErrDatastoreFailed, StageDatastoreGet, model, err))
+	}
+
+	// An expired model has no item either, but it is not a tombstone.
+	if s.negative != nil && s.negative.persist && !expired && isTombstone(model) {
+		if expires := model.Modified.Add(s.negative.ttl); s.now().Before(expires) {
+			s.negative.remember(model.ID, expires, s.now())
+			return fmt.Errorf("propagated item is unknown to the fallback service: %w", s.newError(ErrNotFound, StageDatastoreGet, model, nil))
+		}
+	}
+	stored := model.Item != nil
+
+	var versionErr error
+	if model.Item != nil {
+		versionErr = s.runStage(ctx, StageVersionCheck, model, func(ctx context.Context) (Outcome, error) {
+			if err := s.validateVersion(model); err != nil {
+				return OutcomeOutdated, err
+			}
+			return OutcomeOK, nil
+		})
 	}
 
-	if err := s.validateVersion(model.Version); err != nil || model.Item == nil {
+	if versionErr != nil || model.Item == nil {
 		if s.fallbackService == nil {
-			return fmt.Errorf("could not get propagated item from fallback service: %w", ErrMissingFallbackService.Wrap(err))
+			return fmt.Errorf("could not get propagated item from fallback service: %w", s.newError(ErrMissingFallbackService, StageFallback, model, versionErr))
 		}
 
-		if err := s.fallbackService.Get(ctx, model.Item); err != nil {
-			return fmt.Errorf("could not get propagated item from fallback service: %w", ErrServiceFailed.Wrap(err))
+		if model.Item == nil {
+			// Nothing is stored yet, so the fallback service populates the caller's item directly.
+			model.Item = item
 		}
 
-		if err := s.Save(ctx, model.Item); err != nil {
+		err = s.runStage(ctx, StageFallback, model, func(ctx context.Context) (Outcome, error) {
+			return OutcomeOK, s.fallbackService.Get(ctx, model.Item)
+		})
+		if err != nil {
+			if s.negative != nil && errors.Is(err, ErrNotFound) {
+				s.rememberNotFound(ctx, model, stored)
+			}
+			return fmt.Errorf("could not get propagated item from fallback service: %w", s.newError(ErrServiceFailed, StageFallback, model, err))
+		}
+
+		if s.writeBacks != nil {
+			writeBack := model.Item
+			if cloner, ok := writeBack.(Cloner); ok {
+				writeBack = cloner.Clone()
+			}
+			s.writeBacks.submit(writeBack, func(ctx context.Context) error {
+				return s.save(ctx, writeBack, StageWriteBack)
+			})
+		} else if err := s.save(ctx, model.Item, StageWriteBack); err != nil {
 			return fmt.Errorf("could not save propagated item from fallback service: %w", err)
 		}
 	}
 
-	return item.PopulateFromItem(model.Item)
+	if model.Item == item {
+		return nil
+	}
+
+	return s.runStage(ctx, StagePopulate, model, func(ctx context.Context) (Outcome, error) {
+		return OutcomeOK, item.PopulateFromItem(model.Item)
+	})
+}
+
+// rememberNotFound remembers that the fallback service does not know the ID of model and, if the
+// negative cache is persisted and nothing else is stored for the ID, saves a tombstone for it. Saving
+// the tombstone is best effort; a failure is only reported to the observer.
+func (s *service) rememberNotFound(ctx context.Context, model *Model, stored bool) {
+	now := s.now()
+	s.negative.remember(model.ID, now.Add(s.negative.ttl), now)
+
+	if !s.negative.persist || stored {
+		return
+	}
+
+	tombstone := NewModel(model.ID, s.itemType, 0)
+	tombstone.Created = now
+	tombstone.Modified = now
+	tombstone.Expires = now.Add(s.negative.ttl)
+	s.runStage(ctx, StageWriteBack, tombstone, func(ctx context.Context) (Outcome, error) {
+		return OutcomeOK, s.datastore.Save(ctx, tombstone)
+	})
 }
 
-func (s *service) validateVersion(version int) error {
-	if s.requiredVersion > 0 && s.requiredVersion > version {
-		return fmt.Errorf("version mismatch (required %d; current %d): %w", s.requiredVersion, version, ErrVersionOutdated)
+func (s *service) validateVersion(model *Model) error {
+	if s.requiredVersion > 0 && s.requiredVersion > model.Version {
+		return s.newError(ErrVersionOutdated, StageVersionCheck, model, nil)
 	}
 	return nil
 }
 
 // Save stores propagated data based on the (propagated) item passed in. If the item's current version is higher than 0, we will assume it's the most current and update the version.
-func (s *service) Save(ctx context.Context, item Item) error {
+// The stored model is Modified at the time of saving, as are items written back by Get.
+func (s *service) Save(ctx context.Context, item Item) (err error) {
+	model := NewModel(item.GetID(), s.itemType, item.GetCurrentVersion())
+
+	ctx, span := s.startSpan(ctx, "Service.Save", model.ID)
+	defer func() { endSpan(span, model, outcomeOf(err), err) }()
+
+	if s.negative != nil {
+		s.negative.forget(model.ID)
+	}
+
+	return s.save(ctx, item, StageDatastoreSave)
+}
+
+// Close drains the write-back pool of the service, then closes its datastore and fallback service if
+// they are Closers.
+func (s *service) Close(ctx context.Context) error {
+	values := []interface{}{s.datastore, s.fallbackService}
+	if s.writeBacks != nil {
+		values = append([]interface{}{s.writeBacks}, values...)
+	}
+	return CloseAll(ctx, values...)
+}
+
+func (s *service) save(ctx context.Context, item Item, stage Stage) error {
 	model := NewModel(item.GetID(), s.itemType, item.GetCurrentVersion())
 	model.Item = item
+	model.Modified = s.now()
+	model.Expires = s.expires(item)
 
-	if err := s.datastore.Save(ctx, model); err != nil {
-		return ErrDatastoreFailed.Wrap(err)
+	err := s.runStage(ctx, stage, model, func(ctx context.Context) (Outcome, error) {
+		return OutcomeOK, s.datastore.Save(ctx, model)
+	})
+	if err != nil {
+		return s.newError(ErrDatastoreFailed, stage, model, err)
 	}
 
 	return nil
 }
+
+// expires returns when item expires once saved.
+func (s *service) expires(item Item) time.Time {
+	if expiring, ok := item.(ExpiringItem); ok {
+		return expiring.GetExpires()
+	}
+	if s.expiry > 0 {
+		return s.now().Add(s.expiry)
+	}
+	return time.Time{}
+}
+
+// runStage runs fn as a stage of an operation on model in its own span and reports how it ended to
+// the observer. A stage that fails while claiming OutcomeOK is reported as OutcomeError.
+func (s *service) runStage(ctx context.Context, stage Stage, model *Model, fn func(ctx context.Context) (Outcome, error)) error {
+	ctx, span := s.startSpan(ctx, string(stage), model.ID)
+
+	start := time.Now()
+	outcome, err := fn(ctx)
+	if err != nil && outcome == OutcomeOK {
+		outcome = OutcomeError
+	}
+
+	endSpan(span, model, outcome, err)
+
+	if s.observer != nil {
+		s.observer.Observe(ctx, Event{
+			Type:            s.itemType,
+			ID:              model.ID,
+			Stage:           stage,
+			Outcome:         outcome,
+			RequiredVersion: s.requiredVersion,
+			StoredVersion:   model.Version,
+			Duration:        time.Since(start),
+			Err:             err,
+		})
+	}
+
+	return err
+}
+
+// newError creates a new error of the given kind carrying the context of this service and model.
+func (s *service) newError(kind *BaseError, stage Stage, model *Model, err error) *Error {
+	e := kind.Wrap(err)
+	e.Type = s.itemType
+	e.ID = model.ID
+	e.Stage = stage
+	e.RequiredVersion = s.requiredVersion
+	e.StoredVersion = model.Version
+
+	return e
+}
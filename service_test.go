@@ -47,7 +47,7 @@ func TestGet_PopulateFromItemError(t *testing.T) {
 	)
 
 	// Expect
-	datastore.On("Get", ctx, MockModel(inputItem, testType)).Return(nil, MockModelWithItem(responseItem, testType))
+	datastore.On("Get", mock.Anything, MockModel(inputItem, testType)).Return(nil, MockModelWithItem(responseItem, testType))
 	inputItem.On("PopulateFromItem", responseItem).Return(errors.New("error"))
 
 	// Apply
@@ -77,7 +77,7 @@ func TestGet_DatastoreError(t *testing.T) {
 	)
 
 	// Expect
-	datastore.On("Get", ctx, MockModel(inputItem, testType)).Return(errors.New("error"))
+	datastore.On("Get", mock.Anything, MockModel(inputItem, testType)).Return(errors.New("error"))
 
 	// Apply
 	service := propagatedstorage.NewService(datastore, testType, 1, nil)
@@ -107,7 +107,7 @@ func TestGet_VersionMismatch(t *testing.T) {
 	)
 
 	// Expect
-	datastore.On("Get", ctx, MockModel(inputItem, testType)).Return(nil, MockModelWithItem(responseItem, testType))
+	datastore.On("Get", mock.Anything, MockModel(inputItem, testType)).Return(nil, MockModelWithItem(responseItem, testType))
 
 	// Apply
 	service := propagatedstorage.NewService(datastore, testType, 1, nil)
@@ -139,8 +139,8 @@ func TestGet_FallbackServiceFailed(t *testing.T) {
 	)
 
 	// Expect
-	datastore.On("Get", ctx, MockModel(inputItem, testType)).Return(nil, MockModelWithItem(responseItem, testType))
-	fallbackService.On("Get", ctx, responseItem).Return(errors.New("error"))
+	datastore.On("Get", mock.Anything, MockModel(inputItem, testType)).Return(nil, MockModelWithItem(responseItem, testType))
+	fallbackService.On("Get", mock.Anything, responseItem).Return(errors.New("error"))
 
 	// Apply
 	service := propagatedstorage.NewService(datastore, testType, 1, fallbackService)
@@ -172,12 +172,12 @@ func TestGet_UpdatePropagatedItemFailed(t *testing.T) {
 	)
 
 	// Expect
-	datastore.On("Get", ctx, MockModel(inputItem, testType)).Return(nil, MockModelWithItem(datastoreResponseItem, testType))
-	fallbackService.On("Get", ctx, datastoreResponseItem).Return(nil, serviceResponseItem)
-	datastore.On("Save", ctx, MockModelWithItem(serviceResponseItem, testType)).Return(errors.New("error"))
+	datastore.On("Get", mock.Anything, MockModel(inputItem, testType)).Return(nil, MockModelWithItem(datastoreResponseItem, testType))
+	fallbackService.On("Get", mock.Anything, datastoreResponseItem).Return(nil, serviceResponseItem)
+	datastore.On("Save", mock.Anything, MockSavedModel(serviceResponseItem, testType)).Return(errors.New("error"))
 
 	// Apply
-	service := propagatedstorage.NewService(datastore, testType, 1, fallbackService)
+	service := propagatedstorage.NewService(datastore, testType, 1, fallbackService, propagatedstorage.WithClock(MockClock))
 	err := service.Get(ctx, inputItem)
 
 	// Assert
@@ -206,13 +206,13 @@ func TestGet_UpdatePropagatedItemSuccess(t *testing.T) {
 	)
 
 	// Expect
-	datastore.On("Get", ctx, MockModel(inputItem, testType)).Return(nil, MockModelWithItem(datastoreResponseItem, testType))
-	fallbackService.On("Get", ctx, datastoreResponseItem).Return(nil, serviceResponseItem)
-	datastore.On("Save", ctx, MockModelWithItem(serviceResponseItem, testType)).Return(nil)
+	datastore.On("Get", mock.Anything, MockModel(inputItem, testType)).Return(nil, MockModelWithItem(datastoreResponseItem, testType))
+	fallbackService.On("Get", mock.Anything, datastoreResponseItem).Return(nil, serviceResponseItem)
+	datastore.On("Save", mock.Anything, MockSavedModel(serviceResponseItem, testType)).Return(nil)
 	inputItem.On("PopulateFromItem", serviceResponseItem).Return(nil)
 
 	// Apply
-	service := propagatedstorage.NewService(datastore, testType, 1, fallbackService)
+	service := propagatedstorage.NewService(datastore, testType, 1, fallbackService, propagatedstorage.WithClock(MockClock))
 	err := service.Get(ctx, inputItem)
 
 	// Assert
@@ -238,7 +238,7 @@ func TestGet_Success(t *testing.T) {
 	)
 
 	// Expect
-	datastore.On("Get", ctx, MockModel(inputItem, testType)).Return(nil, MockModelWithItem(responseItem, testType))
+	datastore.On("Get", mock.Anything, MockModel(inputItem, testType)).Return(nil, MockModelWithItem(responseItem, testType))
 	inputItem.On("PopulateFromItem", responseItem).Return(nil)
 
 	// Apply
@@ -267,10 +267,10 @@ func TestSave_DatastoreError(t *testing.T) {
 	)
 
 	// Expect
-	datastore.On("Save", ctx, MockModelWithItem(inputItem, testType)).Return(errors.New("error"))
+	datastore.On("Save", mock.Anything, MockSavedModel(inputItem, testType)).Return(errors.New("error"))
 
 	// Apply
-	service := propagatedstorage.NewService(datastore, testType, 0, nil)
+	service := propagatedstorage.NewService(datastore, testType, 0, nil, propagatedstorage.WithClock(MockClock))
 	err := service.Save(ctx, inputItem)
 
 	// Assert
@@ -296,10 +296,10 @@ func TestSave_Success(t *testing.T) {
 	)
 
 	// Expect
-	datastore.On("Save", ctx, MockModelWithItem(inputItem, testType)).Return(nil)
+	datastore.On("Save", mock.Anything, MockSavedModel(inputItem, testType)).Return(nil)
 
 	// Apply
-	service := propagatedstorage.NewService(datastore, testType, 0, nil)
+	service := propagatedstorage.NewService(datastore, testType, 0, nil, propagatedstorage.WithClock(MockClock))
 	err := service.Save(ctx, inputItem)
 
 	// Assert
@@ -0,0 +1,57 @@
+package sqlstore
+
+import (
+	"fmt"
+)
+
+// Dialect describes the parts of SQL that differ between databases.
+type Dialect interface {
+	// Placeholder returns the placeholder of the n-th query argument, starting at 1.
+	Placeholder(n int) string
+	// CreateTable returns the statement that creates table if it does not exist yet.
+	CreateTable(table string) string
+}
+
+// Postgres is the dialect of PostgreSQL.
+var Postgres Dialect = postgres{}
+
+// SQLite is the dialect of SQLite, version 3.24 or later.
+var SQLite Dialect = sqlite{}
+
+type postgres struct{}
+
+func (postgres) Placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (postgres) CreateTable(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	type TEXT NOT NULL,
+	id TEXT NOT NULL,
+	version BIGINT NOT NULL,
+	item BYTEA,
+	created TIMESTAMPTZ NOT NULL,
+	modified TIMESTAMPTZ NOT NULL,
+	expires TIMESTAMPTZ,
+	PRIMARY KEY (type, id)
+)`, table)
+}
+
+type sqlite struct{}
+
+func (sqlite) Placeholder(n int) string {
+	return "?"
+}
+
+func (sqlite) CreateTable(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	type TEXT NOT NULL,
+	id TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	item BLOB,
+	created TIMESTAMP NOT NULL,
+	modified TIMESTAMP NOT NULL,
+	expires TIMESTAMP,
+	PRIMARY KEY (type, id)
+)`, table)
+}
@@ -0,0 +1,222 @@
+// Package sqlstore provides a propagated storage datastore on top of database/sql. Models are stored
+// in a single table keyed on Type and ID, with their item serialized by a propagatedstorage.Codec.
+// Expired models are kept in the table, as DynamoDB keeps them until it gets to delete them; services
+// read them as misses.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+)
+
+// DefaultTable is the name of the table used unless WithTable says otherwise.
+const DefaultTable = "propagatedstorage"
+
+// Datastore is a propagated storage datastore backed by a SQL database. Saving never replaces a model
+// with an older version of itself.
+type Datastore struct {
+	db      *sql.DB
+	dialect Dialect
+	codec   propagatedstorage.Codec
+	table   string
+}
+
+// Option configures optional behaviour of a SQL datastore.
+type Option func(ds *Datastore)
+
+// WithTable sets the table the models are stored in. The name is used in statements as is, so it must
+// be a valid identifier of the database.
+func WithTable(table string) Option {
+	return func(ds *Datastore) {
+		ds.table = table
+	}
+}
+
+// New returns a new SQL datastore storing models in db. dialect must match the database behind db and
+// codec must be able to decode every Type that is stored. db stays owned by the caller; the datastore
+// never closes it.
+func New(db *sql.DB, dialect Dialect, codec propagatedstorage.Codec, opts ...Option) *Datastore {
+	ds := &Datastore{
+		db:      db,
+		dialect: dialect,
+		codec:   codec,
+		table:   DefaultTable,
+	}
+
+	for _, opt := range opts {
+		opt(ds)
+	}
+
+	return ds
+}
+
+// CreateSchema creates the table of the datastore and its index of models by Modified time if they
+// do not exist yet.
+func (ds *Datastore) CreateSchema(ctx context.Context) error {
+	if _, err := ds.db.ExecContext(ctx, ds.dialect.CreateTable(ds.table)); err != nil {
+		return fmt.Errorf("could not create table %s: %w", ds.table, err)
+	}
+
+	statement := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_modified ON %[1]s (type, modified, id)", ds.table)
+	if _, err := ds.db.ExecContext(ctx, statement); err != nil {
+		return fmt.Errorf("could not create index %s_modified: %w", ds.table, err)
+	}
+	return nil
+}
+
+// Get populates model with the stored model of the same Type and ID, even if it expired.
+func (ds *Datastore) Get(ctx context.Context, model *propagatedstorage.Model) error {
+	query := fmt.Sprintf("SELECT version, item, created, modified, expires FROM %s WHERE type = %s AND id = %s",
+		ds.table, ds.dialect.Placeholder(1), ds.dialect.Placeholder(2))
+
+	var (
+		version           int
+		data              []byte
+		created, modified time.Time
+		expires           sql.NullTime
+	)
+	err := ds.db.QueryRowContext(ctx, query, string(model.Type), model.ID).Scan(&version, &data, &created, &modified, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		e := propagatedstorage.ErrNotFound.Wrap(err)
+		e.Type = model.Type
+		e.ID = model.ID
+		return e
+	}
+	if err != nil {
+		return err
+	}
+
+	item, err := ds.codec.Unmarshal(model.Type, data)
+	if err != nil {
+		return err
+	}
+
+	model.Version = version
+	model.Item = item
+	model.Created = created
+	model.Modified = modified
+	model.Expires = expires.Time
+
+	return nil
+}
+
+// Save stores model, replacing the stored model of the same Type and ID unless that has a newer
+// version. Saving an outdated model fails with propagatedstorage.ErrVersionOutdated.
+func (ds *Datastore) Save(ctx context.Context, model *propagatedstorage.Model) error {
+	data, err := ds.codec.Marshal(model.Item)
+	if err != nil {
+		return fmt.Errorf("could not encode item: %w", err)
+	}
+
+	p := ds.dialect.Placeholder
+	statement := fmt.Sprintf(`INSERT INTO %[1]s (type, id, version, item, created, modified, expires) VALUES (%[2]s, %[3]s, %[4]s, %[5]s, %[6]s, %[7]s, %[8]s)
+ON CONFLICT (type, id) DO UPDATE SET version = excluded.version, item = excluded.item, created = excluded.created, modified = excluded.modified, expires = excluded.expires
+WHERE %[1]s.version <= excluded.version`, ds.table, p(1), p(2), p(3), p(4), p(5), p(6), p(7))
+
+	expires := sql.NullTime{Time: model.Expires.UTC(), Valid: !model.Expires.IsZero()}
+	result, err := ds.db.ExecContext(ctx, statement, string(model.Type), model.ID, model.Version, data, model.Created.UTC(), model.Modified.UTC(), expires)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		e := propagatedstorage.ErrVersionOutdated.Wrap(errors.New("a newer version is already stored"))
+		e.Type = model.Type
+		e.ID = model.ID
+		return e
+	}
+
+	return nil
+}
+
+// Delete removes the stored model of the same Type and ID as model.
+func (ds *Datastore) Delete(ctx context.Context, model *propagatedstorage.Model) error {
+	statement := fmt.Sprintf("DELETE FROM %s WHERE type = %s AND id = %s", ds.table, ds.dialect.Placeholder(1), ds.dialect.Placeholder(2))
+
+	_, err := ds.db.ExecContext(ctx, statement, string(model.Type), model.ID)
+	return err
+}
+
+// ScanIDs calls fn with the ID of every stored model of itemType.
+func (ds *Datastore) ScanIDs(ctx context.Context, itemType propagatedstorage.Type, fn func(id string) error) error {
+	query := fmt.Sprintf("SELECT id FROM %s WHERE type = %s", ds.table, ds.dialect.Placeholder(1))
+
+	rows, err := ds.db.QueryContext(ctx, query, string(itemType))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ChangedSince returns a batch of the models of itemType modified after the watermark of since or
+// cursor, in Modified and then ID order. The query is served by the index CreateSchema creates.
+func (ds *Datastore) ChangedSince(ctx context.Context, itemType propagatedstorage.Type, since time.Time, cursor string) (*propagatedstorage.Changes, error) {
+	watermark, err := propagatedstorage.StartWatermark(itemType, since, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	p := ds.dialect.Placeholder
+	query := fmt.Sprintf(`SELECT id, version, item, created, modified, expires FROM %s
+WHERE type = %s AND (modified > %s OR (modified = %s AND id > %s)) AND (expires IS NULL OR expires > %s)
+ORDER BY modified, id LIMIT %d`, ds.table, p(1), p(2), p(3), p(4), p(5), propagatedstorage.DefaultPageSize+1)
+
+	modified := watermark.Modified.UTC()
+	rows, err := ds.db.QueryContext(ctx, query, string(itemType), modified, modified, watermark.ID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := new(propagatedstorage.Changes)
+	for rows.Next() {
+		if len(changes.Models) == propagatedstorage.DefaultPageSize {
+			changes.More = true
+			break
+		}
+
+		var (
+			model   = propagatedstorage.NewModel("", itemType, 0)
+			data    []byte
+			expires sql.NullTime
+		)
+		if err := rows.Scan(&model.ID, &model.Version, &data, &model.Created, &model.Modified, &expires); err != nil {
+			return nil, err
+		}
+		model.Expires = expires.Time
+		if model.Item, err = ds.codec.Unmarshal(itemType, data); err != nil {
+			return nil, err
+		}
+		changes.Models = append(changes.Models, model)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if n := len(changes.Models); n > 0 {
+		watermark = propagatedstorage.Watermark{Modified: changes.Models[n-1].Modified, ID: changes.Models[n-1].ID}
+	}
+	changes.Cursor = watermark.Cursor()
+
+	return changes, nil
+}
@@ -0,0 +1,132 @@
+package sqlstore_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/datastoretest"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
+	"github.com/Tanax/propagatedstorage/sqlstore"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCodec() *propagatedstorage.JSONCodec {
+	codec := propagatedstorage.NewJSONCodec()
+	for _, itemType := range []propagatedstorage.Type{datastoretest.Type, datastoretest.OtherType} {
+		codec.Register(itemType, func() propagatedstorage.Item { return new(propagatedstoragetest.Item) })
+	}
+	return codec
+}
+
+func newDatastore(t *testing.T) *sqlstore.Datastore {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "propagatedstorage.db"))
+	require.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	// SQLite allows a single writer at a time.
+	db.SetMaxOpenConns(1)
+
+	datastore := sqlstore.New(db, sqlstore.SQLite, newCodec(), sqlstore.WithTable("propagated"))
+	require.Nil(t, datastore.CreateSchema(context.TODO()))
+	require.Nil(t, datastore.CreateSchema(context.TODO()), "creating the schema must be idempotent")
+
+	return datastore
+}
+
+func TestConformance(t *testing.T) {
+	datastoretest.RunConformanceTests(t, func(t *testing.T) propagatedstorage.Datastore {
+		return newDatastore(t)
+	})
+}
+
+func TestSave_KeepsNewerVersion(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		datastore = newDatastore(t)
+		newer     = propagatedstorage.NewModel("ThisIsMyID", datastoretest.Type, 2)
+		older     = propagatedstorage.NewModel("ThisIsMyID", datastoretest.Type, 1)
+	)
+	newer.Item = propagatedstoragetest.NewItem(datastoretest.Type, "ThisIsMyID", 2, "newer")
+	older.Item = propagatedstoragetest.NewItem(datastoretest.Type, "ThisIsMyID", 1, "older")
+
+	// Apply
+	newerErr := datastore.Save(ctx, newer)
+	olderErr := datastore.Save(ctx, older)
+
+	model := propagatedstorage.NewModel("ThisIsMyID", datastoretest.Type, 0)
+	getErr := datastore.Get(ctx, model)
+
+	// Assert
+	assert.Nil(t, newerErr)
+	assert.True(t, errors.Is(olderErr, propagatedstorage.ErrVersionOutdated))
+	assert.Nil(t, getErr)
+	assert.Equal(t, 2, model.Version)
+	assert.Equal(t, newer.Item, model.Item)
+}
+
+func TestSave_Expires(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		datastore = newDatastore(t)
+		now       = time.Now().UTC().Truncate(time.Millisecond)
+		expiring  = propagatedstorage.NewModel("expiring", datastoretest.Type, 1)
+		expired   = propagatedstorage.NewModel("expired", datastoretest.Type, 1)
+	)
+	expiring.Modified = now
+	expiring.Expires = now.Add(time.Hour)
+	expired.Modified = now
+	expired.Expires = now.Add(-time.Hour)
+
+	// Apply
+	require.Nil(t, datastore.Save(ctx, expiring))
+	require.Nil(t, datastore.Save(ctx, expired))
+
+	stored := propagatedstorage.NewModel("expired", datastoretest.Type, 0)
+	getErr := datastore.Get(ctx, stored)
+	changes, changesErr := datastore.ChangedSince(ctx, datastoretest.Type, now, "")
+
+	// Assert
+	assert.Nil(t, getErr)
+	assert.True(t, expired.Expires.Equal(stored.Expires), "expired models must be read with their expiry")
+	assert.Nil(t, changesErr)
+	require.Len(t, changes.Models, 1, "expired models must be left out of changes")
+	assert.True(t, expiring.Expires.Equal(changes.Models[0].Expires))
+}
+
+func TestGet_UnknownType(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		datastore = newDatastore(t)
+		model     = propagatedstorage.NewModel("ThisIsMyID", "Unregistered", 1)
+	)
+	model.Item = propagatedstoragetest.NewItem("Unregistered", "ThisIsMyID", 1, "")
+
+	// Apply
+	saveErr := datastore.Save(ctx, model)
+	getErr := datastore.Get(ctx, propagatedstorage.NewModel("ThisIsMyID", "Unregistered", 0))
+
+	// Assert
+	assert.Nil(t, saveErr)
+	assert.True(t, errors.Is(getErr, propagatedstorage.ErrUnknownType))
+}
+
+func TestDialect_Postgres(t *testing.T) {
+	// Apply
+	statement := sqlstore.Postgres.CreateTable("propagated")
+
+	// Assert
+	assert.Equal(t, "$3", sqlstore.Postgres.Placeholder(3))
+	assert.Contains(t, statement, "CREATE TABLE IF NOT EXISTS propagated")
+	assert.Contains(t, statement, fmt.Sprintf("PRIMARY KEY (%s, %s)", "type", "id"))
+}
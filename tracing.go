@@ -0,0 +1,66 @@
+package propagatedstorage
+
+import (
+	"context"
+	"errors"
+
+	"go.opencensus.io/trace"
+)
+
+const spanPrefix = "github.com/Tanax/propagatedstorage."
+
+// Span attribute keys set on every span started by the service.
+const (
+	AttributeType            = "propagatedstorage.type"
+	AttributeID              = "propagatedstorage.id"
+	AttributeRequiredVersion = "propagatedstorage.required_version"
+	AttributeStoredVersion   = "propagatedstorage.stored_version"
+	AttributeOutcome         = "propagatedstorage.outcome"
+)
+
+// startSpan starts a span for an operation of the service. The span is carried by the returned
+// context, so it is the parent of every span started further down, including those of the
+// fallback service.
+func (s *service) startSpan(ctx context.Context, name string, id string) (context.Context, *trace.Span) {
+	ctx, span := trace.StartSpan(ctx, spanPrefix+name)
+	span.AddAttributes(
+		trace.StringAttribute(AttributeType, string(s.itemType)),
+		trace.StringAttribute(AttributeID, id),
+		trace.Int64Attribute(AttributeRequiredVersion, int64(s.requiredVersion)),
+	)
+
+	return ctx, span
+}
+
+// endSpan records the outcome of an operation on its span and ends it.
+func endSpan(span *trace.Span, model *Model, outcome Outcome, err error) {
+	span.AddAttributes(
+		trace.Int64Attribute(AttributeStoredVersion, int64(model.Version)),
+		trace.StringAttribute(AttributeOutcome, string(outcome)),
+	)
+	if err != nil {
+		span.SetStatus(trace.Status{Code: spanStatusCode(err), Message: err.Error()})
+	}
+
+	span.End()
+}
+
+func spanStatusCode(err error) int32 {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return trace.StatusCodeCancelled
+	case errors.Is(err, context.DeadlineExceeded):
+		return trace.StatusCodeDeadlineExceeded
+	case errors.Is(err, ErrVersionOutdated):
+		return trace.StatusCodeFailedPrecondition
+	default:
+		return trace.StatusCodeUnknown
+	}
+}
+
+func outcomeOf(err error) Outcome {
+	if err != nil {
+		return OutcomeError
+	}
+	return OutcomeOK
+}
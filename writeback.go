@@ -0,0 +1,106 @@
+package propagatedstorage
+
+import (
+	"context"
+	"sync"
+)
+
+// WriteBackErrorHandler is called with every item a WriteBackPool could not write back, and why.
+type WriteBackErrorHandler func(item Item, err error)
+
+type writeBack struct {
+	item Item
+	save func(ctx context.Context) error
+}
+
+// WriteBackPool writes items fetched from fallback services back to their datastores in the
+// background, so readers don't wait for, or fail on, the write. A pool can be shared by several
+// services. It is safe for concurrent use.
+type WriteBackPool struct {
+	onError WriteBackErrorHandler
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan writeBack
+	done   chan struct{}
+}
+
+// NewWriteBackPool starts a pool of workers writing back items queued by services, with room for
+// queueSize items waiting to be written. onError, if not nil, is called with every failed write back.
+// A pool has at least one worker, so fewer workers are raised to one.
+func NewWriteBackPool(workers, queueSize int, onError WriteBackErrorHandler) *WriteBackPool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	p := &WriteBackPool{
+		onError: onError,
+		queue:   make(chan writeBack, queueSize),
+		done:    make(chan struct{}),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for wb := range p.queue {
+				p.write(wb)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(p.done)
+	}()
+
+	return p
+}
+
+// Close stops accepting write backs and waits until the queued ones are written or ctx is done. Write
+// backs submitted after Close are written by the submitting reader.
+func (p *WriteBackPool) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// submit queues the write back of item. When the queue is full, or the pool is closed, the item is
+// written right away instead, which holds readers back until the workers catch up. Failures are
+// reported to the error handler either way.
+func (p *WriteBackPool) submit(item Item, save func(ctx context.Context) error) {
+	wb := writeBack{item: item, save: save}
+
+	p.mu.RLock()
+	if !p.closed {
+		select {
+		case p.queue <- wb:
+			p.mu.RUnlock()
+			return
+		default:
+		}
+	}
+	p.mu.RUnlock()
+
+	p.write(wb)
+}
+
+func (p *WriteBackPool) write(wb writeBack) {
+	// The reader that fetched the item may be gone by now, so the write must not depend on its context.
+	if err := wb.save(context.Background()); err != nil && p.onError != nil {
+		p.onError(wb.item, err)
+	}
+}
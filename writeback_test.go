@@ -0,0 +1,140 @@
+package propagatedstorage_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/memstore"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingDatastore is a memstore datastore whose saves wait until release is closed.
+type blockingDatastore struct {
+	*memstore.Datastore
+	release chan struct{}
+}
+
+func (ds *blockingDatastore) Save(ctx context.Context, model *propagatedstorage.Model) error {
+	<-ds.release
+	return ds.Datastore.Save(ctx, model)
+}
+
+func TestGet_AsyncWriteBack(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		fallback  = propagatedstoragetest.NewFakeService()
+		datastore = &blockingDatastore{Datastore: memstore.New(), release: make(chan struct{})}
+		pool      = propagatedstorage.NewWriteBackPool(1, 10, nil)
+		service   = propagatedstorage.NewService(datastore, TestType, 0, fallback, propagatedstorage.WithWriteBackPool(pool))
+	)
+	fallback.SetItem(propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 1, "from owner"))
+
+	// Apply
+	item := propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 0, "")
+	err := service.Get(ctx, item)
+	pending := datastore.Len()
+	close(datastore.release)
+	closeErr := pool.Close(ctx)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, "from owner", item.Payload)
+	assert.Equal(t, 0, pending, "Get must not wait for the write back")
+	assert.Nil(t, closeErr)
+	assert.Equal(t, 1, datastore.Len(), "Close must drain outstanding write backs")
+}
+
+func TestNewWriteBackPool_NoWorkers(t *testing.T) {
+	// Setup
+	var (
+		ctx       = context.TODO()
+		fallback  = propagatedstoragetest.NewFakeService()
+		datastore = memstore.New()
+		pool      = propagatedstorage.NewWriteBackPool(0, 10, nil)
+		service   = propagatedstorage.NewService(datastore, TestType, 0, fallback, propagatedstorage.WithWriteBackPool(pool))
+	)
+	fallback.SetItem(propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 1, "from owner"))
+
+	// Apply
+	err := service.Get(ctx, propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 0, ""))
+	closeErr := pool.Close(ctx)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Nil(t, closeErr)
+	assert.Equal(t, 1, datastore.Len(), "a pool without workers must still write back")
+}
+
+func TestGet_AsyncWriteBackFailure(t *testing.T) {
+	// Setup
+	var (
+		ctx      = context.TODO()
+		fallback = propagatedstoragetest.NewFakeService()
+		mu       sync.Mutex
+		failures []error
+		pool     = propagatedstorage.NewWriteBackPool(2, 10, func(item propagatedstorage.Item, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failures = append(failures, err)
+		})
+		service = propagatedstorage.NewService(
+			propagatedstorage.InterceptDatastore(memstore.New(), func(ctx context.Context, call *propagatedstorage.Call, next propagatedstorage.Handler) error {
+				if call.Operation == propagatedstorage.OperationDatastoreSave {
+					return errors.New("throttled")
+				}
+				return next(ctx, call)
+			}),
+			TestType, 0, fallback, propagatedstorage.WithWriteBackPool(pool))
+	)
+	fallback.SetItem(propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 1, "from owner"))
+
+	// Apply
+	item := propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 0, "")
+	err := service.Get(ctx, item)
+	require.Nil(t, pool.Close(ctx))
+
+	// Assert
+	assert.Nil(t, err, "a failed write back must not fail the read")
+	assert.Equal(t, "from owner", item.Payload)
+	require.Len(t, failures, 1)
+	assert.True(t, errors.Is(failures[0], propagatedstorage.ErrDatastoreFailed))
+
+	var e *propagatedstorage.Error
+	require.True(t, errors.As(failures[0], &e))
+	assert.Equal(t, propagatedstorage.StageWriteBack, e.Stage)
+	assert.Equal(t, "ThisIsMyID", e.ID)
+}
+
+func TestWriteBackPool_Close(t *testing.T) {
+	// Setup
+	var (
+		datastore = &blockingDatastore{Datastore: memstore.New(), release: make(chan struct{})}
+		fallback  = propagatedstoragetest.NewFakeService()
+		pool      = propagatedstorage.NewWriteBackPool(1, 10, nil)
+		service   = propagatedstorage.NewService(datastore, TestType, 0, fallback, propagatedstorage.WithWriteBackPool(pool))
+	)
+	fallback.SetItem(propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 1, "from owner"))
+	fallback.SetItem(propagatedstoragetest.NewItem(TestType, "AnotherID", 1, "from owner"))
+	require.Nil(t, service.Get(context.TODO(), propagatedstoragetest.NewItem(TestType, "ThisIsMyID", 0, "")))
+
+	// Apply
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	timedOut := pool.Close(ctx)
+	close(datastore.release)
+	drained := pool.Close(context.TODO())
+	afterClose := service.Get(context.TODO(), propagatedstoragetest.NewItem(TestType, "AnotherID", 0, ""))
+
+	// Assert
+	assert.True(t, errors.Is(timedOut, context.DeadlineExceeded))
+	assert.Nil(t, drained)
+	assert.Nil(t, afterClose)
+	assert.Equal(t, 2, datastore.Len(), "write backs after Close must be written by the reader")
+}
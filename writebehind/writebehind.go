@@ -0,0 +1,426 @@
+// Package writebehind provides a propagated storage datastore that buffers saves and writes them to
+// another datastore, such as the DynamoDB one, in batches in the background. Saves of the same Type
+// and ID that are buffered at the same time are coalesced into a single write of the newest version,
+// which takes the load of propagation bursts off the backing datastore.
+//
+// Saves return once buffered, so failures to write them are reported to the error handler set by
+// WithErrorHandler instead of the saver. Buffered saves are lost if the process dies before they
+// are written; Close writes them before returning. Buffered saves are written with a context of their
+// own, limited by WithWriteTimeout, so callers that stop waiting for a write do not make it fail.
+package writebehind
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+)
+
+const (
+	// DefaultMaxBatch is the number of models written in a single batch unless WithMaxBatch says
+	// otherwise. It matches the limit of a DynamoDB batch write.
+	DefaultMaxBatch = 25
+	// DefaultMaxPending is the number of models buffered unless WithMaxPending says otherwise.
+	DefaultMaxPending = 1000
+	// DefaultInterval is how often buffered models are written unless WithInterval says otherwise.
+	DefaultInterval = 100 * time.Millisecond
+	// DefaultWriteTimeout is how long writing the buffered models may take unless WithWriteTimeout
+	// says otherwise.
+	DefaultWriteTimeout = 30 * time.Second
+)
+
+// ErrClosed is returned by saves to a closed write-behind datastore.
+var ErrClosed = propagatedstorage.NewError("write-behind datastore closed")
+
+// ErrorHandler is called with every model that could not be written to the backing datastore.
+type ErrorHandler func(model *propagatedstorage.Model, err error)
+
+type key struct {
+	itemType propagatedstorage.Type
+	id       string
+}
+
+type flushRequest struct {
+	reply chan error
+}
+
+// Datastore is a write-behind datastore. Reads see buffered saves before they are written. It is safe
+// for concurrent use.
+type Datastore struct {
+	backing    propagatedstorage.Datastore
+	maxBatch   int
+	maxPending int
+	interval   time.Duration
+	timeout    time.Duration
+	onError    ErrorHandler
+
+	mu       sync.Mutex
+	pending  map[key]*propagatedstorage.Model
+	inflight map[key]*propagatedstorage.Model
+	flushed  chan struct{}
+	closed   bool
+
+	trigger  chan struct{}
+	requests chan flushRequest
+	closing  chan flushRequest
+	done     chan struct{}
+}
+
+// Option configures optional behaviour of a write-behind datastore.
+type Option func(ds *Datastore)
+
+// WithMaxBatch sets the number of models written in a single batch. A batch is written as soon as
+// that many models are buffered. Values below 1 are raised to 1.
+func WithMaxBatch(max int) Option {
+	return func(ds *Datastore) {
+		if max < 1 {
+			max = 1
+		}
+		ds.maxBatch = max
+	}
+}
+
+// WithMaxPending sets the number of models buffered. Saves of further models block until buffered
+// models are written or their context is done. Values below 1 are raised to 1.
+func WithMaxPending(max int) Option {
+	return func(ds *Datastore) {
+		if max < 1 {
+			max = 1
+		}
+		ds.maxPending = max
+	}
+}
+
+// WithInterval sets how often buffered models are written. Intervals that are not positive leave the
+// default in place.
+func WithInterval(interval time.Duration) Option {
+	return func(ds *Datastore) {
+		if interval > 0 {
+			ds.interval = interval
+		}
+	}
+}
+
+// WithWriteTimeout sets how long writing the buffered models may take. Timeouts that are not positive
+// leave the default in place.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(ds *Datastore) {
+		if timeout > 0 {
+			ds.timeout = timeout
+		}
+	}
+}
+
+// WithErrorHandler sets the handler called with every model that could not be written. Failed models
+// are dropped from the buffer either way.
+func WithErrorHandler(handler ErrorHandler) Option {
+	return func(ds *Datastore) {
+		ds.onError = handler
+	}
+}
+
+// New returns a write-behind datastore in front of backing, writing buffered models in the background
+// until it is closed.
+func New(backing propagatedstorage.Datastore, opts ...Option) *Datastore {
+	ds := &Datastore{
+		backing:    backing,
+		maxBatch:   DefaultMaxBatch,
+		maxPending: DefaultMaxPending,
+		interval:   DefaultInterval,
+		timeout:    DefaultWriteTimeout,
+		pending:    make(map[key]*propagatedstorage.Model),
+		inflight:   make(map[key]*propagatedstorage.Model),
+		flushed:    make(chan struct{}),
+		trigger:    make(chan struct{}, 1),
+		requests:   make(chan flushRequest),
+		closing:    make(chan flushRequest),
+		done:       make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(ds)
+	}
+
+	go ds.run()
+	return ds
+}
+
+// Get populates model with the newest of its buffered save and the save being written if there is
+// one, and from the backing datastore otherwise.
+func (ds *Datastore) Get(ctx context.Context, model *propagatedstorage.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	k := key{model.Type, model.ID}
+
+	ds.mu.Lock()
+	buffered, ok := ds.pending[k]
+	if inflight, found := ds.inflight[k]; found && (!ok || inflight.Version > buffered.Version) {
+		buffered, ok = inflight, true
+	}
+	ds.mu.Unlock()
+
+	if ok {
+		*model = *buffered
+		return nil
+	}
+	return ds.backing.Get(ctx, model)
+}
+
+// Save buffers a copy of model to be written later. A buffered save of the same Type and ID is
+// replaced, unless it or a save of the same Type and ID being written has a newer version, in which
+// case model is dropped. Save blocks while the
+// buffer is full, until there is room or ctx is done, and fails with ErrClosed once the datastore is
+// closed.
+func (ds *Datastore) Save(ctx context.Context, model *propagatedstorage.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	k := key{model.Type, model.ID}
+	buffered := *model
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	for {
+		if ds.closed {
+			e := ErrClosed.Wrap(nil)
+			e.Type = model.Type
+			e.ID = model.ID
+			return e
+		}
+
+		if inflight, ok := ds.inflight[k]; ok && inflight.Version > model.Version {
+			return nil
+		}
+		if existing, ok := ds.pending[k]; ok {
+			if existing.Version <= model.Version {
+				ds.pending[k] = &buffered
+			}
+			return nil
+		}
+
+		if len(ds.pending) < ds.maxPending {
+			break
+		}
+
+		flushed := ds.flushed
+		ds.flush()
+		ds.mu.Unlock()
+		select {
+		case <-flushed:
+		case <-ctx.Done():
+			ds.mu.Lock()
+			return ctx.Err()
+		}
+		ds.mu.Lock()
+	}
+
+	ds.pending[k] = &buffered
+	if len(ds.pending) >= ds.maxBatch {
+		ds.flush()
+	}
+	return nil
+}
+
+// Delete drops the buffered save of model, waits for it to be written if that is underway, and then
+// deletes it from the backing datastore.
+func (ds *Datastore) Delete(ctx context.Context, model *propagatedstorage.Model) error {
+	k := key{model.Type, model.ID}
+
+	ds.mu.Lock()
+	delete(ds.pending, k)
+	for {
+		if _, ok := ds.inflight[k]; !ok {
+			break
+		}
+		flushed := ds.flushed
+		ds.mu.Unlock()
+		select {
+		case <-flushed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		ds.mu.Lock()
+	}
+	ds.mu.Unlock()
+
+	return propagatedstorage.Delete(ctx, ds.backing, model)
+}
+
+// ScanIDs writes the buffered models, then scans the IDs stored in the backing datastore.
+func (ds *Datastore) ScanIDs(ctx context.Context, itemType propagatedstorage.Type, fn func(id string) error) error {
+	if err := ds.Flush(ctx); err != nil {
+		return err
+	}
+	return propagatedstorage.ScanIDs(ctx, ds.backing, itemType, fn)
+}
+
+// List writes the buffered models, then lists the models stored in the backing datastore.
+func (ds *Datastore) List(ctx context.Context, itemType propagatedstorage.Type, filter propagatedstorage.ListFilter, pageToken string) (*propagatedstorage.Page, error) {
+	if err := ds.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return propagatedstorage.List(ctx, ds.backing, itemType, filter, pageToken)
+}
+
+// ChangedSince writes the buffered models, then lists the models changed in the backing datastore.
+func (ds *Datastore) ChangedSince(ctx context.Context, itemType propagatedstorage.Type, since time.Time, cursor string) (*propagatedstorage.Changes, error) {
+	if err := ds.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return propagatedstorage.ChangedSince(ctx, ds.backing, itemType, since, cursor)
+}
+
+// Flush writes the buffered models and waits until they are written or ctx is done. The models are
+// written whether or not ctx is done before. Models that could not be written are reported in a
+// *propagatedstorage.BatchError, by their order of writing.
+func (ds *Datastore) Flush(ctx context.Context) error {
+	return ds.request(ctx, ds.requests)
+}
+
+// Close writes the buffered models, as Flush does, stops the background writer and closes the backing
+// datastore. Saves fail with ErrClosed from then on. If ctx is done before the background writer has
+// stopped, Close fails with the error of ctx and leaves the backing datastore open for the writer;
+// calling Close again closes it once the writer has stopped.
+func (ds *Datastore) Close(ctx context.Context) error {
+	ds.mu.Lock()
+	ds.closed = true
+	ds.mu.Unlock()
+
+	err := ds.request(ctx, ds.closing)
+	select {
+	case <-ds.done:
+	case <-ctx.Done():
+		select {
+		case <-ds.done:
+		default:
+			// The background writer may still write to the backing datastore.
+			return ctx.Err()
+		}
+	}
+
+	var errs propagatedstorage.Errors
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if err := propagatedstorage.CloseAll(ctx, ds.backing); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Len returns the number of buffered models.
+func (ds *Datastore) Len() int {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return len(ds.pending)
+}
+
+func (ds *Datastore) request(ctx context.Context, requests chan flushRequest) error {
+	request := flushRequest{reply: make(chan error, 1)}
+
+	select {
+	case requests <- request:
+	case <-ds.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-request.reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush asks the background writer to write the buffered models soon.
+func (ds *Datastore) flush() {
+	select {
+	case ds.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (ds *Datastore) run() {
+	defer close(ds.done)
+
+	ticker := time.NewTicker(ds.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ds.write()
+		case <-ds.trigger:
+			ds.write()
+		case request := <-ds.requests:
+			request.reply <- ds.write()
+		case request := <-ds.closing:
+			request.reply <- ds.write()
+			return
+		}
+	}
+}
+
+// write writes the buffered models in batches and reports the models that failed.
+func (ds *Datastore) write() error {
+	ctx, cancel := context.WithTimeout(context.Background(), ds.timeout)
+	defer cancel()
+
+	ds.mu.Lock()
+	ds.inflight, ds.pending = ds.pending, ds.inflight
+	models := make([]*propagatedstorage.Model, 0, len(ds.inflight))
+	for _, model := range ds.inflight {
+		models = append(models, model)
+	}
+	ds.mu.Unlock()
+
+	errs := make(map[int]error)
+	for start := 0; start < len(models); start += ds.maxBatch {
+		end := start + ds.maxBatch
+		if end > len(models) {
+			end = len(models)
+		}
+
+		err := propagatedstorage.SaveBatch(ctx, ds.backing, models[start:end])
+		if err == nil {
+			continue
+		}
+
+		batchErr, ok := err.(*propagatedstorage.BatchError)
+		if !ok {
+			batchErr = &propagatedstorage.BatchError{Errors: make(map[int]error)}
+			for i := range models[start:end] {
+				batchErr.Errors[i] = err
+			}
+		}
+		for i, err := range batchErr.Errors {
+			errs[start+i] = err
+			if ds.onError != nil {
+				ds.onError(models[start+i], err)
+			}
+		}
+	}
+
+	ds.mu.Lock()
+	ds.inflight = make(map[key]*propagatedstorage.Model)
+	close(ds.flushed)
+	ds.flushed = make(chan struct{})
+	ds.mu.Unlock()
+
+	if len(errs) > 0 {
+		return &propagatedstorage.BatchError{Errors: errs}
+	}
+	return nil
+}
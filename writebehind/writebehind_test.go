@@ -0,0 +1,334 @@
+package writebehind_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tanax/propagatedstorage"
+	"github.com/Tanax/propagatedstorage/datastoretest"
+	"github.com/Tanax/propagatedstorage/memstore"
+	"github.com/Tanax/propagatedstorage/propagatedstoragetest"
+	"github.com/Tanax/propagatedstorage/writebehind"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testType propagatedstorage.Type = "TestType"
+
+// recordingDatastore is a memstore datastore recording the batches saved to it.
+type recordingDatastore struct {
+	*memstore.Datastore
+
+	mu      sync.Mutex
+	batches [][]*propagatedstorage.Model
+	block   chan struct{}
+	// writing is closed as the first batch is saved.
+	writing     chan struct{}
+	writingOnce sync.Once
+	closed      bool
+}
+
+func (ds *recordingDatastore) SaveBatch(ctx context.Context, models []*propagatedstorage.Model) error {
+	if ds.writing != nil {
+		ds.writingOnce.Do(func() { close(ds.writing) })
+	}
+	if ds.block != nil {
+		<-ds.block
+	}
+
+	ds.mu.Lock()
+	ds.batches = append(ds.batches, models)
+	ds.mu.Unlock()
+
+	return propagatedstorage.SaveBatch(ctx, ds.Datastore, models)
+}
+
+func (ds *recordingDatastore) Close(ctx context.Context) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.closed = true
+	return nil
+}
+
+func (ds *recordingDatastore) Closed() bool {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return ds.closed
+}
+
+func (ds *recordingDatastore) Batches() [][]*propagatedstorage.Model {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return ds.batches
+}
+
+func newModel(id string, version int) *propagatedstorage.Model {
+	model := propagatedstorage.NewModel(id, testType, version)
+	model.Item = propagatedstoragetest.NewItem(testType, id, version, fmt.Sprintf("version %d", version))
+	return model
+}
+
+func TestConformance(t *testing.T) {
+	datastoretest.RunConformanceTests(t, func(t *testing.T) propagatedstorage.Datastore {
+		ds := writebehind.New(memstore.New(), writebehind.WithInterval(time.Millisecond))
+		t.Cleanup(func() { ds.Close(context.Background()) })
+		return ds
+	})
+}
+
+func TestSave_Coalesces(t *testing.T) {
+	// Setup
+	var (
+		ctx     = context.TODO()
+		backing = &recordingDatastore{Datastore: memstore.New()}
+		ds      = writebehind.New(backing, writebehind.WithInterval(time.Hour))
+	)
+	defer ds.Close(ctx)
+
+	// Apply
+	require.Nil(t, ds.Save(ctx, newModel("ThisIsMyID", 1)))
+	require.Nil(t, ds.Save(ctx, newModel("ThisIsMyID", 3)))
+	require.Nil(t, ds.Save(ctx, newModel("ThisIsMyID", 2)))
+	require.Nil(t, ds.Save(ctx, newModel("AnotherID", 1)))
+
+	buffered := propagatedstorage.NewModel("ThisIsMyID", testType, 0)
+	getErr := ds.Get(ctx, buffered)
+	flushErr := ds.Flush(ctx)
+
+	// Assert
+	assert.Nil(t, getErr)
+	assert.Equal(t, 3, buffered.Version, "reads must see buffered saves")
+	assert.Nil(t, flushErr)
+	require.Len(t, backing.Batches(), 1)
+	assert.Len(t, backing.Batches()[0], 2, "saves of the same Type and ID must be coalesced")
+
+	stored := propagatedstorage.NewModel("ThisIsMyID", testType, 0)
+	require.Nil(t, backing.Get(ctx, stored))
+	assert.Equal(t, 3, stored.Version, "the newest version must win")
+}
+
+func TestSave_DropsSavesOlderThanWrites(t *testing.T) {
+	// Setup
+	var (
+		ctx     = context.TODO()
+		backing = &recordingDatastore{Datastore: memstore.New(), block: make(chan struct{})}
+		ds      = writebehind.New(backing, writebehind.WithInterval(time.Hour))
+	)
+	defer ds.Close(ctx)
+	require.Nil(t, ds.Save(ctx, newModel("ThisIsMyID", 2)))
+	flushed := make(chan error)
+	go func() { flushed <- ds.Flush(ctx) }()
+	propagatedstoragetest.Eventually(t, func() bool { return ds.Len() == 0 }, "version 2 must be written")
+
+	// Apply
+	require.Nil(t, ds.Save(ctx, newModel("ThisIsMyID", 1)))
+	buffered := propagatedstorage.NewModel("ThisIsMyID", testType, 0)
+	getErr := ds.Get(ctx, buffered)
+	close(backing.block)
+	firstErr := <-flushed
+	secondErr := ds.Flush(ctx)
+
+	// Assert
+	assert.Nil(t, getErr)
+	assert.Equal(t, 2, buffered.Version, "reads must see the newest save")
+	assert.Nil(t, firstErr)
+	assert.Nil(t, secondErr)
+	stored := propagatedstorage.NewModel("ThisIsMyID", testType, 0)
+	require.Nil(t, backing.Get(ctx, stored))
+	assert.Equal(t, 2, stored.Version, "a save older than the one being written must be dropped")
+}
+
+func TestList_CanceledCallerKeepsSaves(t *testing.T) {
+	// Setup
+	var (
+		ctx     = context.TODO()
+		backing = &recordingDatastore{Datastore: memstore.New(), block: make(chan struct{}), writing: make(chan struct{})}
+		failed  []*propagatedstorage.Model
+		ds      = writebehind.New(backing, writebehind.WithInterval(time.Hour), writebehind.WithErrorHandler(func(model *propagatedstorage.Model, err error) {
+			failed = append(failed, model)
+		}))
+		listCtx, cancel = context.WithCancel(ctx)
+	)
+	defer ds.Close(ctx)
+	for i := 0; i < 3; i++ {
+		require.Nil(t, ds.Save(ctx, newModel(fmt.Sprintf("id-%d", i), 1)))
+	}
+
+	// Apply
+	listed := make(chan error)
+	go func() {
+		_, err := ds.List(listCtx, testType, propagatedstorage.ListFilter{}, "")
+		listed <- err
+	}()
+	<-backing.writing
+	cancel()
+	listErr := <-listed
+	close(backing.block)
+	flushErr := ds.Flush(ctx)
+
+	// Assert
+	assert.True(t, errors.Is(listErr, context.Canceled))
+	assert.Nil(t, flushErr)
+	assert.Empty(t, failed, "the write must not fail with the context of the List")
+	assert.Equal(t, 3, backing.Len())
+}
+
+func TestClose_ContextDoneLeavesBackingOpen(t *testing.T) {
+	// Setup
+	var (
+		backing     = &recordingDatastore{Datastore: memstore.New(), block: make(chan struct{})}
+		ds          = writebehind.New(backing, writebehind.WithInterval(time.Hour))
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	)
+	defer cancel()
+	require.Nil(t, ds.Save(context.TODO(), newModel("ThisIsMyID", 1)))
+
+	// Apply
+	timedOutErr := ds.Close(ctx)
+	closedEarly := backing.Closed()
+	close(backing.block)
+	closeErr := ds.Close(context.TODO())
+
+	// Assert
+	assert.True(t, errors.Is(timedOutErr, context.DeadlineExceeded))
+	assert.False(t, closedEarly, "the backing datastore must stay open while the writer may use it")
+	assert.Nil(t, closeErr)
+	assert.True(t, backing.Closed())
+	assert.Equal(t, 1, backing.Len())
+}
+
+func TestNew_ClampsOptions(t *testing.T) {
+	// Setup
+	var (
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+		backing     = memstore.New()
+		ds          = writebehind.New(backing, writebehind.WithMaxBatch(0), writebehind.WithMaxPending(0), writebehind.WithInterval(0))
+	)
+	defer cancel()
+	defer ds.Close(ctx)
+
+	// Apply
+	firstErr := ds.Save(ctx, newModel("first", 1))
+	secondErr := ds.Save(ctx, newModel("second", 1))
+	flushErr := ds.Flush(ctx)
+
+	// Assert
+	assert.Nil(t, firstErr)
+	assert.Nil(t, secondErr)
+	assert.Nil(t, flushErr)
+	assert.Equal(t, 2, backing.Len())
+}
+
+func TestSave_FlushesFullBatches(t *testing.T) {
+	// Setup
+	var (
+		ctx     = context.TODO()
+		backing = &recordingDatastore{Datastore: memstore.New()}
+		ds      = writebehind.New(backing, writebehind.WithInterval(time.Hour), writebehind.WithMaxBatch(3))
+	)
+	defer ds.Close(ctx)
+
+	// Apply
+	for i := 0; i < 3; i++ {
+		require.Nil(t, ds.Save(ctx, newModel(fmt.Sprintf("id-%d", i), 1)))
+	}
+
+	// Assert
+	propagatedstoragetest.Eventually(t, func() bool { return backing.Len() == 3 })
+}
+
+func TestSave_FlushesOnInterval(t *testing.T) {
+	// Setup
+	var (
+		ctx     = context.TODO()
+		backing = &recordingDatastore{Datastore: memstore.New()}
+		ds      = writebehind.New(backing, writebehind.WithInterval(10*time.Millisecond))
+	)
+	defer ds.Close(ctx)
+
+	// Apply
+	require.Nil(t, ds.Save(ctx, newModel("ThisIsMyID", 1)))
+
+	// Assert
+	propagatedstoragetest.Eventually(t, func() bool { return backing.Len() == 1 })
+}
+
+func TestSave_Backpressure(t *testing.T) {
+	// Setup
+	var (
+		backing = &recordingDatastore{Datastore: memstore.New(), block: make(chan struct{})}
+		ds      = writebehind.New(backing, writebehind.WithInterval(time.Hour), writebehind.WithMaxPending(2))
+	)
+	require.Nil(t, ds.Save(context.TODO(), newModel("first", 1)))
+	require.Nil(t, ds.Save(context.TODO(), newModel("second", 1)))
+
+	// Apply
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	blocked := ds.Save(ctx, newModel("third", 1))
+	close(backing.block)
+	unblocked := ds.Save(context.TODO(), newModel("third", 1))
+
+	// Assert
+	assert.True(t, errors.Is(blocked, context.DeadlineExceeded), "a save into a full buffer must block")
+	assert.Nil(t, unblocked)
+	assert.Nil(t, ds.Close(context.TODO()))
+	assert.Equal(t, 3, backing.Len())
+}
+
+func TestClose_Drains(t *testing.T) {
+	// Setup
+	var (
+		ctx     = context.TODO()
+		backing = memstore.New()
+		ds      = writebehind.New(backing, writebehind.WithInterval(time.Hour))
+	)
+	for i := 0; i < 10; i++ {
+		require.Nil(t, ds.Save(ctx, newModel(fmt.Sprintf("id-%d", i), 1)))
+	}
+
+	// Apply
+	err := ds.Close(ctx)
+	closed := ds.Save(ctx, newModel("late", 1))
+	again := ds.Close(ctx)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, 10, backing.Len())
+	assert.Equal(t, 0, ds.Len())
+	assert.True(t, errors.Is(closed, writebehind.ErrClosed))
+	assert.Nil(t, again)
+}
+
+func TestFlush_ReportsFailures(t *testing.T) {
+	// Setup
+	var (
+		ctx     = context.TODO()
+		backing = propagatedstoragetest.NewFaultyDatastore(memstore.New(), propagatedstoragetest.Faults{BatchErrorRate: 1})
+		mu      sync.Mutex
+		failed  []string
+		ds      = writebehind.New(backing, writebehind.WithInterval(time.Hour), writebehind.WithErrorHandler(func(model *propagatedstorage.Model, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, model.ID)
+		}))
+	)
+	defer ds.Close(ctx)
+	require.Nil(t, ds.Save(ctx, newModel("first", 1)))
+	require.Nil(t, ds.Save(ctx, newModel("second", 1)))
+
+	// Apply
+	err := ds.Flush(ctx)
+
+	// Assert
+	assert.True(t, errors.Is(err, propagatedstoragetest.ErrInjectedFault))
+	assert.ElementsMatch(t, []string{"first", "second"}, failed)
+	assert.Equal(t, 0, ds.Len(), "failed models must be dropped from the buffer")
+}